@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1 // The command ran and failed (sync errors, invalid projects, ...)
+	exitUsage = 2 // Bad command line
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// Assigned in init because the help command refers back to the table
+	commands = []command{
+		{"sync", "", "Sync the repository and reconcile every project with Arcane (default)", runSyncCommand},
+		{"plan", "[--json]", "Show what the next sync would do without changing anything", runPlanCommand},
+		{"status", "[--json]", "Show the last synced state of every project (no fetch, read-only)", runStatusCommand},
+		{"deploy", "[--force] <project>", "Sync the repository and reconcile a single project", runDeployCommand},
+		{"validate", "[--json] [<project>]", "Check every project in the checkout without contacting Arcane", runValidateCommand},
+		{"env", "[--values] <project>", "Show a project's effective env and which file each variable comes from", runEnvCommand},
+		{"projects", "[<action> <project>]", "List projects, or show, start, stop, restart, pull or remove one", runProjectsCommand},
+		{"daemon", "", "Keep running and sync on an interval (and on webhooks)", runDaemon},
+		{"version", "", "Print the version", runVersionCommand},
+		{"help", "", "Show this help", runHelpCommand},
+	}
+}
+
+// runCLI dispatches to a command and returns the process exit code. Running
+// without a command (as the systemd timer unit historically did) syncs.
+func runCLI(args []string) int {
+	global := newFlagSet("arcane-gitops")
+	global.Usage = func() { printUsage(os.Stderr) }
+	if err := global.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	rest := global.Args()
+	name := "sync"
+	if len(rest) > 0 {
+		name, rest = rest[0], rest[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(rest)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: arcane-gitops [flags] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-30s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Configuration flags (accepted before or after the command) override the")
+	fmt.Fprintln(w, "environment and config file:")
+	fs := newFlagSet("arcane-gitops")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// newFlagSet returns a flag set with the configuration flags registered.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, f := range configFlags {
+		fs.Var(&envFlag{key: f.key, kind: f.kind}, f.name, fmt.Sprintf("%s (%s)", f.usage, f.key))
+	}
+	return fs
+}
+
+// parseCommandFlags parses a command's flags, allowing them to appear before
+// or after its positional arguments.
+func parseCommandFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// commandUsage prints a command's own flags; the configuration flags are
+// shared by every command and listed by "arcane-gitops help".
+func commandUsage(fs *flag.FlagSet, name string) {
+	w := fs.Output()
+	for _, cmd := range commands {
+		if cmd.name == name {
+			fmt.Fprintf(w, "Usage: arcane-gitops %s\n\n%s\n", strings.TrimSpace(name+" "+cmd.args), cmd.summary)
+		}
+	}
+
+	own := flag.NewFlagSet(name, flag.ContinueOnError)
+	own.SetOutput(w)
+	hasFlags := false
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, isConfig := f.Value.(*envFlag); !isConfig {
+			own.Var(f.Value, f.Name, f.Usage)
+			hasFlags = true
+		}
+	})
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		own.PrintDefaults()
+	}
+	fmt.Fprintln(w, "\nRun 'arcane-gitops help' for the configuration flags.")
+}
+
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// Configuration flags. Each one sets the environment variable of the same
+// setting, so loadConfig stays the single place that builds a Config.
+var configFlags = []struct {
+	name  string
+	key   string
+	kind  string
+	usage string
+}{
+	{"config", "CONFIG_FILE", "string", "config `file` to read"},
+	{"repo", "COMPOSE_REPO_PATH", "string", "`path` of the compose repository checkout"},
+	{"projects-dir", "PROJECTS_DIR", "string", "repository subdirectory (`path`) holding the projects"},
+	{"projects-depth", "PROJECTS_DEPTH", "int", "search `n` folder levels below the projects directory for projects"},
+	{"arcane-url", "ARCANE_BASE_URL", "string", "Arcane API base `url`"},
+	{"env-id", "ARCANE_ENV_ID", "string", "Arcane environment `id`"},
+	{"env-map", "ARCANE_ENV_MAP", "string", "comma-separated `pattern=id` pairs assigning project folders to Arcane environments"},
+	{"log-file", "LOG_FILE", "string", "log `file`"},
+	{"state-file", "STATE_FILE", "string", "sync state `file`"},
+	{"git-auth", "GIT_AUTH_METHOD", "string", "git authentication `method`: ssh, https or none"},
+	{"ssh-key", "GIT_SSH_KEY_PATH", "string", "SSH private key `file` for git"},
+	{"known-hosts", "GIT_SSH_KNOWN_HOSTS", "string", "known_hosts `file` for SSH remotes"},
+	{"host-key-policy", "GIT_SSH_HOST_KEY_POLICY", "string", "SSH host key `policy`: tofu or strict"},
+	{"age-key", "SOPS_AGE_KEY_FILE", "string", "age identity `file` for decrypting .env.enc and *.sops.env files"},
+	{"prune", "PRUNE_ENABLED", "bool", "remove projects whose folders were deleted"},
+	{"prune-max", "PRUNE_MAX_PER_RUN", "int", "refuse to prune more than `n` projects per run"},
+	{"drift-policy", "DRIFT_POLICY", "string", "`policy` for projects edited in Arcane: off, report or reapply"},
+	{"validate-compose", "COMPOSE_VALIDATION", "bool", "refuse to sync projects whose compose files are invalid"},
+	{"policy", "POLICY_FILE", "string", "policy `file` of rules compose projects must follow (relative to the repository)"},
+	{"include", "SYNC_INCLUDE", "string", "comma-separated project file `patterns` that trigger a redeploy"},
+	{"exclude", "SYNC_EXCLUDE", "string", "comma-separated project file `patterns` to ignore"},
+	{"sync-timeout", "SYNC_TIMEOUT", "duration", "give up on a sync pass after `duration`"},
+	{"project-timeout", "PROJECT_TIMEOUT", "duration", "give up on a single project after `duration`"},
+	{"health-timeout", "HEALTH_TIMEOUT", "duration", "wait up to `duration` for a deployed project to become healthy (0 disables)"},
+	{"rollback", "ROLLBACK_ENABLED", "bool", "roll back updates that fail to deploy to the last good commit"},
+	{"interval", "SYNC_INTERVAL", "duration", "daemon: `duration` between syncs"},
+	{"jitter", "SYNC_JITTER", "duration", "daemon: maximum random `delay` added to each interval"},
+	{"webhook-listen", "WEBHOOK_LISTEN", "string", "daemon: webhook listen `address`"},
+	{"webhook-debounce", "WEBHOOK_DEBOUNCE", "duration", "daemon: quiet `period` after a push before syncing"},
+}
+
+// cliOverrides holds the environment variables set from flags. The config
+// file never overrides them, not even on reload.
+var cliOverrides = make(map[string]bool)
+
+// envFlag is a flag.Value backed by an environment variable. Values are
+// checked when parsed, so a typo fails instead of falling back to a default.
+type envFlag struct {
+	key   string
+	kind  string
+	value string
+}
+
+func (f *envFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *envFlag) Set(value string) error {
+	switch f.kind {
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("must be true or false")
+		}
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.New("must be an integer")
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return errors.New("must be a duration such as 30s or 5m")
+		}
+	}
+	f.value = value
+	cliOverrides[f.key] = true
+	return os.Setenv(f.key, value)
+}
+
+// IsBoolFlag lets boolean settings be given as a bare --flag.
+func (f *envFlag) IsBoolFlag() bool {
+	return f.kind == "bool"
+}
+
+func runHelpCommand(args []string) int {
+	printUsage(os.Stdout)
+	return exitOK
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+func runSyncCommand(args []string) int {
+	fs := newFlagSet("sync")
+	fs.Usage = func() { commandUsage(fs, "sync") }
+	if code, ok := parseNoArgs(fs, args); !ok {
+		return code
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	// Setup logging
+	setupLogging(config.LogFile)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Setup git authentication based on configured method
+	if err := setupGitAuth(ctx, config); err != nil {
+		logError(fmt.Sprintf("Git authentication setup failed: %v", err))
+		return exitError
+	}
+
+	client := newArcaneClient(config)
+	err = runSync(ctx, config, client)
+	switch {
+	case errors.Is(err, errSyncInterrupted):
+		logWarning(fmt.Sprintf("Stopped: %v", err))
+		return exitError
+	case err != nil:
+		logError(fmt.Sprintf("Sync failed: %v", err))
+		return exitError
+	}
+	return exitOK
+}
+
+// signalContext is cancelled on SIGTERM or SIGINT, so a systemd stop or
+// Ctrl-C ends a run between projects instead of killing it mid-deploy.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+}
+
+// parseNoArgs parses flags for commands that take no positional arguments.
+func parseNoArgs(fs *flag.FlagSet, args []string) (int, bool) {
+	positional, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err), false
+	}
+	if len(positional) > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n\n", positional[0])
+		fs.Usage()
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+func runDeployCommand(args []string) int {
+	fs := newFlagSet("deploy")
+	force := fs.Bool("force", false, "update and redeploy even if the project is already in sync")
+	fs.Usage = func() { commandUsage(fs, "deploy") }
+	positional, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "deploy takes exactly one project name")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return exitUsage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	setupLogging(config.LogFile)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if err := setupGitAuth(ctx, config); err != nil {
+		logError(fmt.Sprintf("Git authentication setup failed: %v", err))
+		return exitError
+	}
+
+	client := newArcaneClient(config)
+	if err := deployOne(ctx, config, client, positional[0], *force); err != nil {
+		logError(fmt.Sprintf("Deploy failed: %v", err))
+		return exitError
+	}
+	return exitOK
+}
+
+// deployOne is a sync pass narrowed to a single project. The checkout still
+// moves to the remote head; other projects stay pending in the sync state
+// and are picked up by the next full sync.
+func deployOne(ctx context.Context, config Config, client *arcane.Client, name string, force bool) error {
+	ctx, cancel := context.WithTimeout(ctx, config.SyncTimeout)
+	defer cancel()
+
+	logInfo(fmt.Sprintf("Deploying project: %s", name))
+
+	oldCommit, err := syncGitRepository(ctx, config)
+	if err != nil {
+		return err
+	}
+	newCommit, err := getCurrentCommit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get new commit: %w", err)
+	}
+
+	state, err := loadSyncState(config.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	inv, err := gatherInventory(ctx, config, client, state)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(inv.DiskProjects, name) {
+		if inv.ignore.excludes(name) {
+			return fmt.Errorf("project %s is excluded by %s", name, ignoreFile)
+		}
+		return fmt.Errorf("project %s not found in %s", name, config.RepoPath)
+	}
+	settings, ok := inv.Settings[name]
+	if ok && !settings.Enabled {
+		return fmt.Errorf("project %s is disabled in its %s", name, projectSettingsFile)
+	}
+
+	plan := buildSyncPlan(ctx, config, state, inv, detectChangedProjects(ctx, oldCommit, newCommit, config, inv.DiskProjects), newCommit).forProject(name)
+
+	// Force an update unless the plan already pushes something to Arcane
+	candidates := inv.arcaneProjects(settings.EnvID, settings.Name)
+	if force && len(candidates) > 0 && len(plan.Errors) == 0 {
+		pending := false
+		for _, change := range plan.Changes {
+			pending = pending || change.Action != actionAdopt
+		}
+		if !pending {
+			content, err := readProjectContent(ctx, config, name)
+			if err != nil {
+				return err
+			}
+			// A refused project fails with the plan's errors
+			if plan.admit(config, inv.policy, name, content) {
+				project := selectPreferredProject(candidates)
+				plan.Changes = []PlannedChange{{
+					Project:     name,
+					Action:      actionUpdate,
+					Reason:      "forced by deploy command",
+					ProjectID:   project.ID,
+					Environment: settings.EnvID,
+					content:     content,
+					arcane:      project,
+					settings:    settings,
+				}}
+			}
+		}
+	}
+
+	return applySyncPlan(ctx, config, client, state, plan)
+}
+
+// Project states shown by the status command
+const (
+	statusSynced    = "synced"    // Checkout matches what was last applied
+	statusPending   = "pending"   // Checkout differs from what was last applied
+	statusPinned    = "pinned"    // Checkout failed to deploy and was rolled back
+	statusUntracked = "untracked" // Not in the sync state yet
+	statusRemoved   = "removed"   // In the sync state, but the folder is gone
+	statusInvalid   = "invalid"   // The project folder can't be read
+	statusDisabled  = "disabled"  // Turned off in the project's settings file
+	statusIgnored   = "ignored"   // In the sync state, but the folder is in the ignore file
+)
+
+type projectStatus struct {
+	Name         string     `json:"name"`
+	State        string     `json:"state"`
+	Commit       string     `json:"commit,omitempty"`
+	SyncedAt     *time.Time `json:"syncedAt,omitempty"`
+	ArcaneName   string     `json:"arcaneName,omitempty"`
+	Environment  string     `json:"environment,omitempty"`
+	ArcaneID     string     `json:"arcaneId,omitempty"`
+	ArcaneStatus string     `json:"arcaneStatus,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+type statusReport struct {
+	Repository string          `json:"repository"`
+	Branch     string          `json:"branch"`
+	Commit     string          `json:"commit"`
+	Projects   []projectStatus `json:"projects"`
+}
+
+func runStatusCommand(args []string) int {
+	fs := newFlagSet("status")
+	jsonOutput := fs.Bool("json", false, "print the status as JSON")
+	fs.Usage = func() { commandUsage(fs, "status") }
+	if code, ok := parseNoArgs(fs, args); !ok {
+		return code
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	// Read-only: stay out of the sync log
+	log.SetOutput(io.Discard)
+	consoleOutput = os.Stderr
+
+	report, err := buildStatusReport(context.Background(), config)
+	if err != nil {
+		logError(fmt.Sprintf("Status failed: %v", err))
+		return exitError
+	}
+
+	if *jsonOutput {
+		return printJSON(report)
+	}
+
+	fmt.Printf("Repository: %s (%s @ %s)\n", report.Repository, report.Branch, shortCommit(report.Commit))
+	fmt.Printf("Sync state: %s\n\n", config.StateFile)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tSTATE\tCOMMIT\tSYNCED AT\tARCANE")
+	for _, p := range report.Projects {
+		syncedAt := "-"
+		if p.SyncedAt != nil {
+			syncedAt = p.SyncedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		name := p.Name
+		if p.ArcaneName != "" {
+			name += " as " + p.ArcaneName
+		}
+		if p.Environment != "" {
+			name += " in env " + p.Environment
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, p.State, orDash(shortCommit(p.Commit)), syncedAt, orDash(p.ArcaneStatus))
+	}
+	_ = w.Flush()
+	return exitOK
+}
+
+// buildStatusReport compares the checkout as it is with the sync state. It
+// doesn't fetch, so it shows what the last sync left behind.
+func buildStatusReport(ctx context.Context, config Config) (*statusReport, error) {
+	if err := os.Chdir(config.RepoPath); err != nil {
+		return nil, fmt.Errorf("failed to change to repository directory: %w", err)
+	}
+	branch, err := getCurrentBranch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	commit, err := getCurrentCommit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current commit: %w", err)
+	}
+
+	rules, err := loadIgnoreRules(config)
+	if err != nil {
+		return nil, err
+	}
+	diskProjects, err := scanDiskProjects(config, rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disk projects: %w", err)
+	}
+	state, err := loadSyncState(config.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	// Where each project is, or was, deployed
+	targets := make(map[string]ProjectSettings)
+	settingsErrs := make(map[string]error)
+	for name, entry := range state.Projects {
+		targets[name] = entry.settings(config, name)
+	}
+	for _, name := range diskProjects {
+		if settings, err := loadProjectSettings(config, name); err != nil {
+			settingsErrs[name] = err
+		} else {
+			targets[name] = settings
+		}
+	}
+	var envIDs []string
+	for _, target := range targets {
+		envIDs = append(envIDs, target.EnvID)
+	}
+	sort.Strings(envIDs)
+
+	// Arcane is optional here; the local state is still worth showing
+	arcaneProjects, listErrs := listArcaneProjects(ctx, newArcaneClient(config), envIDs)
+	for _, envID := range slices.Compact(envIDs) {
+		if err := listErrs[envID]; err != nil {
+			logWarning(fmt.Sprintf("Could not list Arcane projects in environment %s: %v", envID, err))
+		}
+	}
+
+	report := &statusReport{Repository: config.RepoPath, Branch: branch, Commit: commit, Projects: []projectStatus{}}
+	addProject := func(name, projectState string) *projectStatus {
+		ps := projectStatus{Name: name, State: projectState}
+		if entry, ok := state.Projects[name]; ok {
+			syncedAt := entry.SyncedAt
+			ps.Commit, ps.SyncedAt = entry.Commit, &syncedAt
+		}
+		if target, ok := targets[name]; ok {
+			if target.Name != name {
+				ps.ArcaneName = target.Name
+			}
+			if target.EnvID != config.ArcaneEnvID {
+				ps.Environment = target.EnvID
+			}
+			if candidates := arcaneProjects[target.EnvID][target.Name]; len(candidates) > 0 {
+				project := selectPreferredProject(candidates)
+				ps.ArcaneID, ps.ArcaneStatus = project.ID, project.Status
+			}
+		}
+		report.Projects = append(report.Projects, ps)
+		return &report.Projects[len(report.Projects)-1]
+	}
+
+	for _, name := range diskProjects {
+		entry, tracked := state.Projects[name]
+		content, err := readProjectContent(ctx, config, name)
+		switch {
+		case settingsErrs[name] != nil:
+			addProject(name, statusInvalid).Error = settingsErrs[name].Error()
+		case !targets[name].Enabled:
+			addProject(name, statusDisabled)
+		case err != nil:
+			addProject(name, statusInvalid).Error = err.Error()
+		case !tracked:
+			addProject(name, statusUntracked)
+		case entry.pinned(content):
+			addProject(name, statusPinned).Error = fmt.Sprintf("rolled back %s: %s", shortCommit(entry.RolledBack.FailedCommit), entry.RolledBack.Reason)
+		case entry.ContentHash != content.Hash(), entry.FilesHash != "" && entry.FilesHash != content.FilesHash:
+			addProject(name, statusPending)
+		default:
+			addProject(name, statusSynced)
+		}
+	}
+	for name := range state.Projects {
+		switch {
+		case slices.Contains(diskProjects, name):
+		case rules.excludes(name):
+			addProject(name, statusIgnored)
+		default:
+			addProject(name, statusRemoved)
+		}
+	}
+
+	sort.Slice(report.Projects, func(i, j int) bool {
+		return report.Projects[i].Name < report.Projects[j].Name
+	})
+	return report, nil
+}
+
+func runVersionCommand(args []string) int {
+	fmt.Printf("arcane-gitops %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return exitOK
+}
+
+func printJSON(v interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		logError(fmt.Sprintf("Failed to encode JSON: %v", err))
+		return exitError
+	}
+	return exitOK
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
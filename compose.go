@@ -0,0 +1,552 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// overrideFileNames are the override files Docker Compose applies on top of
+// the compose file by default, in order of preference.
+var overrideFileNames = []string{"compose.override.yaml", "compose.override.yml", "docker-compose.override.yaml", "docker-compose.override.yml"}
+
+// composeResourceKeys are the top-level sections an included file adds to the
+// project.
+var composeResourceKeys = []string{"services", "networks", "volumes", "configs", "secrets"}
+
+// includePattern spots the include directive without parsing every file.
+var includePattern = regexp.MustCompile(`(?m)^include\s*:`)
+
+// composeFilesFor returns a project's compose files, in the order they are
+// applied, relative to the project folder: the compose_files setting, or else
+// the compose file and its override file, if there is one.
+func composeFilesFor(config Config, projectName string, settings ProjectSettings) ([]string, error) {
+	projectPath := filepath.Join(config.RepoPath, projectName)
+	if len(settings.ComposeFiles) > 0 {
+		for _, file := range settings.ComposeFiles {
+			if _, err := os.Stat(filepath.Join(projectPath, filepath.FromSlash(file))); err != nil {
+				return nil, fmt.Errorf("compose file %s from %s: %w", file, projectSettingsFile, err)
+			}
+		}
+		return settings.ComposeFiles, nil
+	}
+
+	composeFile := findComposeFile(projectPath)
+	if composeFile == "" {
+		return nil, fmt.Errorf("no compose file found in %s", projectPath)
+	}
+	files := []string{filepath.Base(composeFile)}
+	for _, name := range overrideFileNames {
+		if _, err := os.Stat(filepath.Join(projectPath, name)); err == nil {
+			files = append(files, name)
+			break
+		}
+	}
+	return files, nil
+}
+
+// loadCompose returns the compose content uploaded to Arcane. Arcane keeps a
+// single compose file per project, so several files, or one that includes
+// others, are merged into one document the way Docker Compose would merge
+// them. A lone file without includes is uploaded exactly as written.
+//
+// The two forms differ: the merged document is printed by formatYAML, without
+// comments, anchors or the original layout. The content hash and the drift
+// check both use what is uploaded, so they stay consistent, but adding the
+// first override or include (or removing the last) updates the project even
+// when its services don't change, and in a merged project an edit that only
+// touches comments or layout changes nothing that is uploaded and doesn't
+// redeploy it.
+func loadCompose(config Config, projectName string, files []string) (string, error) {
+	if len(files) == 1 {
+		data, err := os.ReadFile(filepath.Join(config.RepoPath, projectName, filepath.FromSlash(files[0])))
+		if err != nil {
+			return "", fmt.Errorf("failed to read compose file: %w", err)
+		}
+		if !includePattern.Match(data) {
+			return string(data), nil
+		}
+	}
+
+	project, err := parseComposeProject(config, projectName, files)
+	if err != nil {
+		return "", err
+	}
+	return formatYAML(project.model), nil
+}
+
+// composeProject is a project's compose files, parsed and merged.
+type composeProject struct {
+	sources []composeSource // Every file read, included ones too, in the order read
+	model   *yamlNode       // The merged document
+}
+
+// composeSource is a parsed compose file, as written.
+type composeSource struct {
+	file string // Path from the repository root
+	doc  *yamlNode
+}
+
+func parseComposeProject(config Config, projectName string, files []string) (*composeProject, error) {
+	// As with Docker Compose, the first file's folder is the project's
+	dir := path.Dir(path.Join(filepath.ToSlash(projectName), files[0]))
+	loader := &composeLoader{root: config.RepoPath, dir: dir, loading: make(map[string]bool)}
+	var merged *yamlNode
+	for _, file := range files {
+		doc, err := loader.load(path.Join(filepath.ToSlash(projectName), file), dir)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = doc
+		} else {
+			merged = mergeComposeNode(nil, merged, doc)
+		}
+	}
+	return &composeProject{sources: loader.sources, model: removeMergeTags(merged)}, nil
+}
+
+// composeLoader reads compose files and inlines what they include.
+type composeLoader struct {
+	root    string          // Repository root; files may not be read outside it
+	dir     string          // Project folder, which relative paths in the merged document are relative to
+	loading map[string]bool // Files being loaded, to catch include cycles
+	sources []composeSource
+}
+
+// load parses a compose file, given by its path from the repository root,
+// with its includes resolved. dir is the folder the relative paths in the
+// file are relative to.
+func (l *composeLoader) load(file, dir string) (*yamlNode, error) {
+	if l.loading[file] {
+		return nil, fmt.Errorf("%s includes itself", file)
+	}
+	l.loading[file] = true
+	defer delete(l.loading, file)
+
+	data, err := os.ReadFile(filepath.Join(l.root, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		var lineErr *yamlError
+		if errors.As(err, &lineErr) {
+			return nil, &fileProblem{File: file, Line: lineErr.Line, Msg: lineErr.Msg}
+		}
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if doc.Kind == yamlNull {
+		doc = &yamlNode{Kind: yamlMapping, Line: doc.Line}
+	}
+	if doc.Kind != yamlMapping {
+		return nil, &fileProblem{File: file, Line: doc.Line, Msg: "expected a mapping, got " + doc.describe()}
+	}
+	l.sources = append(l.sources, composeSource{file: file, doc: doc})
+	doc = rebaseComposePaths(doc, dir, l.dir)
+
+	include := doc.get("include")
+	if include == nil {
+		return doc, nil
+	}
+	return l.inline(file, doc, include)
+}
+
+// inline returns doc with the resources of the files listed under include
+// added, and without the directive. As with Docker Compose, a resource can't
+// be defined both in a file and in something it includes.
+func (l *composeLoader) inline(file string, doc, include *yamlNode) (*yamlNode, error) {
+	fail := func(line int, format string, args ...interface{}) error {
+		return &fileProblem{File: file, Line: line, Msg: "include: " + fmt.Sprintf(format, args...)}
+	}
+	if include.Kind != yamlSequence {
+		return nil, fail(include.Line, "expected a list, got %s", include.describe())
+	}
+
+	result := &yamlNode{Kind: yamlMapping, Line: doc.Line}
+	for _, pair := range doc.Pairs {
+		if pair.Key != "include" {
+			result.Pairs = append(result.Pairs, pair)
+		}
+	}
+
+	for _, entry := range include.Items {
+		var paths []*yamlNode
+		switch entry.Kind {
+		case yamlScalar:
+			paths = []*yamlNode{entry}
+		case yamlMapping:
+			for _, pair := range entry.Pairs {
+				if pair.Key != "path" {
+					// The merged file is deployed from the project folder, so
+					// these can't be honored
+					return nil, fail(pair.Line, "%s is not supported", pair.Key)
+				}
+			}
+			switch value := entry.get("path"); {
+			case value == nil:
+				return nil, fail(entry.Line, "path is required")
+			case value.Kind == yamlScalar:
+				paths = []*yamlNode{value}
+			case value.Kind == yamlSequence:
+				paths = value.Items
+			default:
+				return nil, fail(value.Line, "path: expected a file or a list of files")
+			}
+		default:
+			return nil, fail(entry.Line, "expected a file, got %s", entry.describe())
+		}
+
+		var included *yamlNode
+		for _, p := range paths {
+			if p.Kind != yamlScalar || p.Value == "" {
+				return nil, fail(p.Line, "expected a file, got %s", p.describe())
+			}
+			target := path.Join(path.Dir(file), p.Value)
+			if path.IsAbs(p.Value) || target == ".." || strings.HasPrefix(target, "../") {
+				return nil, fail(p.Line, "%s is outside the repository", p.Value)
+			}
+			// An included file's paths are relative to its own folder
+			loaded, err := l.load(target, path.Dir(target))
+			if err != nil {
+				return nil, err
+			}
+			if included == nil {
+				included = loaded
+			} else {
+				included = mergeComposeNode(nil, included, loaded)
+			}
+		}
+
+		for _, section := range composeResourceKeys {
+			resources := included.get(section)
+			if resources == nil || resources.Kind != yamlMapping {
+				continue
+			}
+			i := slices.IndexFunc(result.Pairs, func(pair yamlPair) bool { return pair.Key == section })
+			if i < 0 {
+				result.Pairs = append(result.Pairs, yamlPair{Key: section, Line: resources.Line})
+				i = len(result.Pairs) - 1
+			}
+			existing := result.Pairs[i].Value
+			target := &yamlNode{Kind: yamlMapping, Line: resources.Line}
+			switch {
+			case existing == nil || existing.Kind == yamlNull:
+			case existing.Kind == yamlMapping:
+				target.Line, target.Pairs = existing.Line, slices.Clone(existing.Pairs)
+			default:
+				return nil, &fileProblem{File: file, Line: existing.Line, Msg: section + ": expected a mapping, got " + existing.describe()}
+			}
+			for _, pair := range resources.Pairs {
+				if target.get(pair.Key) != nil {
+					return nil, fail(entry.Line, "%s.%s is defined both here and in an included file", section, pair.Key)
+				}
+				target.Pairs = append(target.Pairs, pair)
+			}
+			result.Pairs[i].Value = target
+		}
+	}
+	return result, nil
+}
+
+// rebaseComposePaths returns doc with the relative paths it uses (build
+// contexts, env files, bind mounts, config and secret files) moved from being
+// relative to from to being relative to to. doc itself is left as written.
+func rebaseComposePaths(doc *yamlNode, from, to string) *yamlNode {
+	if from == to {
+		return doc
+	}
+	rebase := func(n *yamlNode) *yamlNode {
+		return withValue(n, rebaseComposePath(n.Value, from, to))
+	}
+	only := func(name string) func(string, *yamlNode) *yamlNode {
+		return func(key string, value *yamlNode) *yamlNode {
+			if key == name {
+				return rebase(value)
+			}
+			return value
+		}
+	}
+
+	return mapPairs(doc, func(section string, resources *yamlNode) *yamlNode {
+		switch section {
+		case "configs", "secrets":
+			return mapPairs(resources, func(_ string, resource *yamlNode) *yamlNode {
+				return mapPairs(resource, only("file"))
+			})
+		case "services":
+		default:
+			return resources
+		}
+		return mapPairs(resources, func(_ string, service *yamlNode) *yamlNode {
+			return mapPairs(service, func(key string, value *yamlNode) *yamlNode {
+				switch key {
+				case "build":
+					if value.Kind == yamlScalar {
+						return rebase(value)
+					}
+					return mapPairs(value, only("context"))
+				case "env_file":
+					if value.Kind == yamlScalar {
+						return rebase(value)
+					}
+					return mapItems(value, func(item *yamlNode) *yamlNode {
+						if item.Kind == yamlMapping {
+							return mapPairs(item, only("path"))
+						}
+						return rebase(item)
+					})
+				case "volumes":
+					return mapItems(value, func(item *yamlNode) *yamlNode {
+						if item.Kind == yamlMapping {
+							if mountType := item.get("type"); mountType == nil || mountType.Value != "bind" {
+								return item
+							}
+							return mapPairs(item, only("source"))
+						}
+						// Relative bind mounts start with a dot; anything else
+						// is a named volume or an absolute path
+						source, target, found := strings.Cut(item.Value, ":")
+						if !found || !strings.HasPrefix(source, ".") {
+							return item
+						}
+						return withValue(item, rebaseComposePath(source, from, to)+":"+target)
+					})
+				}
+				return value
+			})
+		})
+	})
+}
+
+// rebaseComposePath makes a path relative to from relative to to instead,
+// leaving absolute paths, home directories, variables and URLs alone. The
+// result starts with ./ or ../, as bind mounts need.
+func rebaseComposePath(p, from, to string) string {
+	if p == "" || path.IsAbs(p) || strings.HasPrefix(p, "~") || strings.HasPrefix(p, "$") ||
+		strings.Contains(p, "://") || strings.HasPrefix(p, "git@") {
+		return p
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(to), filepath.FromSlash(path.Join(from, p)))
+	if err != nil {
+		return p
+	}
+	switch rel = filepath.ToSlash(rel); {
+	case rel == "." || rel == ".." || strings.HasPrefix(rel, "../"):
+		return rel
+	}
+	return "./" + rel
+}
+
+// withValue returns a copy of a scalar with another value.
+func withValue(n *yamlNode, value string) *yamlNode {
+	if n == nil || n.Kind != yamlScalar || n.Value == value {
+		return n
+	}
+	copied := *n
+	copied.Value = value
+	return &copied
+}
+
+// mapPairs returns a copy of a mapping with each value replaced by what edit
+// returns for it. Anything but a mapping is returned as it is.
+func mapPairs(n *yamlNode, edit func(key string, value *yamlNode) *yamlNode) *yamlNode {
+	if n == nil || n.Kind != yamlMapping {
+		return n
+	}
+	copied := *n
+	copied.Pairs = slices.Clone(n.Pairs)
+	for i, pair := range copied.Pairs {
+		copied.Pairs[i].Value = edit(pair.Key, pair.Value)
+	}
+	return &copied
+}
+
+// mapItems is mapPairs for sequences.
+func mapItems(n *yamlNode, edit func(item *yamlNode) *yamlNode) *yamlNode {
+	if n == nil || n.Kind != yamlSequence {
+		return n
+	}
+	copied := *n
+	copied.Items = slices.Clone(n.Items)
+	for i, item := range copied.Items {
+		copied.Items[i] = edit(item)
+	}
+	return &copied
+}
+
+// Service attributes whose lists are merged by something other than plain
+// appending, following the Compose specification's merge rules.
+var (
+	// Replaced outright by an override
+	composeReplacedKeys = []string{"command", "entrypoint", "healthcheck.test"}
+	// Lists of KEY=VALUE (or mappings), merged by key
+	composeKeyValueKeys = []string{"environment", "labels", "annotations", "sysctls", "build.args", "build.labels", "deploy.labels"}
+	// Mounts, merged by where they are mounted
+	composeMountKeys = []string{"volumes", "devices", "secrets", "configs"}
+	// Lists of names (or mappings keyed by name)
+	composeNameKeys = []string{"networks", "depends_on"}
+)
+
+// mergeComposeNode applies override on top of base. keys is where the two
+// are in the document, e.g. ["services", "web", "environment"].
+func mergeComposeNode(keys []string, base, override *yamlNode) *yamlNode {
+	if override.Tag == "!reset" || override.Tag == "!override" {
+		return override
+	}
+
+	attr := serviceAttr(keys)
+	switch {
+	case slices.Contains(composeReplacedKeys, attr):
+		return override
+	case slices.Contains(composeKeyValueKeys, attr):
+		base, override = keyValueMapping(base), keyValueMapping(override)
+	case slices.Contains(composeNameKeys, attr) && (base.Kind == yamlMapping || override.Kind == yamlMapping):
+		base, override = nameMapping(attr, base), nameMapping(attr, override)
+	}
+
+	switch {
+	case base.Kind == yamlMapping && override.Kind == yamlMapping:
+		merged := &yamlNode{Kind: yamlMapping, Line: base.Line, Tag: base.Tag, Pairs: slices.Clone(base.Pairs)}
+		for _, pair := range override.Pairs {
+			i := slices.IndexFunc(merged.Pairs, func(existing yamlPair) bool { return existing.Key == pair.Key })
+			if i < 0 {
+				merged.Pairs = append(merged.Pairs, pair)
+				continue
+			}
+			merged.Pairs[i].Value = mergeComposeNode(append(slices.Clone(keys), pair.Key), merged.Pairs[i].Value, pair.Value)
+		}
+		return merged
+
+	case base.Kind == yamlSequence && override.Kind == yamlSequence:
+		merged := &yamlNode{Kind: yamlSequence, Line: base.Line, Items: slices.Clone(base.Items)}
+		for _, item := range override.Items {
+			if slices.Contains(composeMountKeys, attr) {
+				// The same mount point replaces the earlier mount
+				if i := slices.IndexFunc(merged.Items, func(existing *yamlNode) bool {
+					return mountTarget(existing) != "" && mountTarget(existing) == mountTarget(item)
+				}); i >= 0 {
+					merged.Items[i] = item
+					continue
+				}
+			}
+			if !slices.ContainsFunc(merged.Items, func(existing *yamlNode) bool { return sameScalar(existing, item) }) {
+				merged.Items = append(merged.Items, item)
+			}
+		}
+		return merged
+	}
+	return override
+}
+
+// serviceAttr names the service attribute at keys, such as "build.args", or
+// returns "" outside services.
+func serviceAttr(keys []string) string {
+	if len(keys) < 3 || keys[0] != "services" {
+		return ""
+	}
+	return strings.Join(keys[2:], ".")
+}
+
+// keyValueMapping turns a list of KEY=VALUE strings into a mapping. Values
+// are strings, as they were in the list.
+func keyValueMapping(n *yamlNode) *yamlNode {
+	if n.Kind != yamlSequence {
+		return n
+	}
+	mapping := &yamlNode{Kind: yamlMapping, Line: n.Line}
+	for _, item := range n.Items {
+		key, value, found := strings.Cut(item.Value, "=")
+		pair := yamlPair{Key: key, Line: item.Line, Value: &yamlNode{Kind: yamlNull, Line: item.Line}}
+		if found {
+			pair.Value = &yamlNode{Kind: yamlScalar, Value: value, Quoted: true, Line: item.Line}
+		}
+		if i := slices.IndexFunc(mapping.Pairs, func(existing yamlPair) bool { return existing.Key == key }); i >= 0 {
+			mapping.Pairs[i] = pair
+		} else {
+			mapping.Pairs = append(mapping.Pairs, pair)
+		}
+	}
+	return mapping
+}
+
+// nameMapping turns a list of names into the equivalent mapping.
+func nameMapping(key string, n *yamlNode) *yamlNode {
+	if n.Kind != yamlSequence {
+		return n
+	}
+	mapping := &yamlNode{Kind: yamlMapping, Line: n.Line}
+	for _, item := range n.Items {
+		value := &yamlNode{Kind: yamlNull, Line: item.Line}
+		if key == "depends_on" {
+			value = &yamlNode{Kind: yamlMapping, Line: item.Line, Pairs: []yamlPair{
+				{Key: "condition", Line: item.Line, Value: &yamlNode{Kind: yamlScalar, Value: "service_started", Line: item.Line}},
+			}}
+		}
+		mapping.Pairs = append(mapping.Pairs, yamlPair{Key: item.Value, Line: item.Line, Value: value})
+	}
+	return mapping
+}
+
+// mountTarget is where a volume, device, secret or config ends up in the
+// container, which identifies it when merging.
+func mountTarget(n *yamlNode) string {
+	switch n.Kind {
+	case yamlScalar:
+		parts := strings.Split(n.Value, ":")
+		if len(parts) > 1 {
+			return parts[1]
+		}
+		return parts[0]
+	case yamlMapping:
+		if target := n.get("target"); target != nil {
+			return target.Value
+		}
+		if source := n.get("source"); source != nil {
+			return source.Value
+		}
+	}
+	return ""
+}
+
+func sameScalar(a, b *yamlNode) bool {
+	return a.Kind == yamlScalar && b.Kind == yamlScalar && a.Value == b.Value
+}
+
+// removeMergeTags drops what !reset clears and unmarks what !override
+// replaced, once every file has been merged.
+func removeMergeTags(n *yamlNode) *yamlNode {
+	switch n.Kind {
+	case yamlMapping:
+		pairs := make([]yamlPair, 0, len(n.Pairs))
+		for _, pair := range n.Pairs {
+			if pair.Value.Tag != "!reset" {
+				pairs = append(pairs, yamlPair{Key: pair.Key, Line: pair.Line, Value: removeMergeTags(pair.Value)})
+			}
+		}
+		return &yamlNode{Kind: yamlMapping, Line: n.Line, Tag: mergeTagless(n.Tag), Pairs: pairs}
+	case yamlSequence:
+		items := make([]*yamlNode, 0, len(n.Items))
+		for _, item := range n.Items {
+			if item.Tag != "!reset" {
+				items = append(items, removeMergeTags(item))
+			}
+		}
+		return &yamlNode{Kind: yamlSequence, Line: n.Line, Tag: mergeTagless(n.Tag), Items: items}
+	}
+	clone := *n
+	clone.Tag = mergeTagless(n.Tag)
+	return &clone
+}
+
+func mergeTagless(tag string) string {
+	if tag == "!reset" || tag == "!override" {
+		return ""
+	}
+	return tag
+}
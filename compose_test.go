@@ -0,0 +1,250 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeFiles creates files, given by their path from dir with slashes.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// nodeAt follows keys through mappings, and through sequences for numeric
+// keys, returning nil when something is missing.
+func nodeAt(n *yamlNode, keys ...string) *yamlNode {
+	for _, key := range keys {
+		if i, err := strconv.Atoi(key); err == nil && n != nil && n.Kind == yamlSequence {
+			if i >= len(n.Items) {
+				return nil
+			}
+			n = n.Items[i]
+			continue
+		}
+		n = n.get(key)
+	}
+	return n
+}
+
+func TestParseComposeProjectRebasesIncludedPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"apps/web/compose.yaml": `include:
+  - ../shared/db.yaml
+services:
+  web:
+    image: nginx:1.29
+    build: ./web
+    volumes:
+      - ./html:/usr/share/nginx/html
+`,
+		"apps/shared/db.yaml": `services:
+  db:
+    image: postgres:16
+    build:
+      context: ./image
+      dockerfile: Dockerfile
+    env_file:
+      - db.env
+      - path: ./extra.env
+        required: false
+    volumes:
+      - ./init:/docker-entrypoint-initdb.d:ro
+      - dbdata:/var/lib/postgresql/data
+      - /srv/backup:/backup
+      - type: bind
+        source: ../conf
+        target: /conf
+  cache:
+    image: redis:7
+    build: https://github.com/example/cache.git
+    env_file: ${CACHE_ENV}
+configs:
+  pgconf:
+    file: ./pg.conf
+secrets:
+  pgpass:
+    file: pgpass.txt
+volumes:
+  dbdata: {}
+`,
+	})
+
+	project, err := parseComposeProject(Config{RepoPath: dir}, "apps/web", []string{"compose.yaml"})
+	if err != nil {
+		t.Fatalf("parseComposeProject: %v", err)
+	}
+
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		// The including file's own paths are left as written
+		{[]string{"services", "web", "build"}, "./web"},
+		{[]string{"services", "web", "volumes", "0"}, "./html:/usr/share/nginx/html"},
+
+		{[]string{"services", "db", "build", "context"}, "../shared/image"},
+		{[]string{"services", "db", "build", "dockerfile"}, "Dockerfile"},
+		{[]string{"services", "db", "env_file", "0"}, "../shared/db.env"},
+		{[]string{"services", "db", "env_file", "1", "path"}, "../shared/extra.env"},
+		{[]string{"services", "db", "volumes", "0"}, "../shared/init:/docker-entrypoint-initdb.d:ro"},
+		{[]string{"services", "db", "volumes", "1"}, "dbdata:/var/lib/postgresql/data"},
+		{[]string{"services", "db", "volumes", "2"}, "/srv/backup:/backup"},
+		{[]string{"services", "db", "volumes", "3", "source"}, "../conf"},
+		{[]string{"services", "cache", "build"}, "https://github.com/example/cache.git"},
+		{[]string{"services", "cache", "env_file"}, "${CACHE_ENV}"},
+		{[]string{"configs", "pgconf", "file"}, "../shared/pg.conf"},
+		{[]string{"secrets", "pgpass", "file"}, "../shared/pgpass.txt"},
+	}
+	for _, tt := range tests {
+		got := nodeAt(project.model, tt.keys...)
+		if got == nil {
+			t.Errorf("%v: missing", tt.keys)
+			continue
+		}
+		if got.Value != tt.want {
+			t.Errorf("%v = %q, want %q", tt.keys, got.Value, tt.want)
+		}
+	}
+
+	// The sources stay as written, for error locations
+	if len(project.sources) != 2 || project.sources[1].file != "apps/shared/db.yaml" {
+		t.Fatalf("sources = %v, want apps/web/compose.yaml and apps/shared/db.yaml", project.sources)
+	}
+	if got := nodeAt(project.sources[1].doc, "services", "db", "build", "context"); got == nil || got.Value != "./image" {
+		t.Errorf("source changed: build.context = %v", got)
+	}
+}
+
+func TestMergeComposeNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name:     "mappings merge and scalars are replaced",
+			base:     "services:\n  web:\n    image: nginx:1.28\n    restart: always\n",
+			override: "services:\n  web:\n    image: nginx:1.29\n  db:\n    image: redis:7\n",
+			want:     "services:\n  web:\n    image: nginx:1.29\n    restart: always\n  db:\n    image: redis:7\n",
+		},
+		{
+			name:     "lists are appended without duplicates",
+			base:     "services:\n  web:\n    ports:\n      - 80:80\n      - 443:443\n",
+			override: "services:\n  web:\n    ports:\n      - 443:443\n      - 8080:8080\n",
+			want:     "services:\n  web:\n    ports:\n      - 80:80\n      - 443:443\n      - 8080:8080\n",
+		},
+		{
+			name:     "command is replaced",
+			base:     "services:\n  web:\n    command: [nginx, -g, daemon off;]\n",
+			override: "services:\n  web:\n    command: [nginx-debug]\n",
+			want:     "services:\n  web:\n    command:\n      - nginx-debug\n",
+		},
+		{
+			name:     "healthcheck test is replaced",
+			base:     "services:\n  web:\n    healthcheck:\n      test: [CMD, curl, localhost]\n      interval: 10s\n",
+			override: "services:\n  web:\n    healthcheck:\n      test: [CMD, wget, localhost]\n",
+			want:     "services:\n  web:\n    healthcheck:\n      test:\n        - CMD\n        - wget\n        - localhost\n      interval: 10s\n",
+		},
+		{
+			name:     "environment lists and mappings merge by key",
+			base:     "services:\n  web:\n    environment:\n      - MODE=dev\n      - TZ=UTC\n",
+			override: "services:\n  web:\n    environment:\n      MODE: prod\n      DEBUG:\n",
+			want:     "services:\n  web:\n    environment:\n      MODE: prod\n      TZ: \"UTC\"\n      DEBUG:\n",
+		},
+		{
+			name:     "volumes merge by mount point",
+			base:     "services:\n  web:\n    volumes:\n      - ./html:/usr/share/nginx/html\n      - logs:/var/log\n",
+			override: "services:\n  web:\n    volumes:\n      - type: bind\n        source: ./site\n        target: /usr/share/nginx/html\n",
+			want:     "services:\n  web:\n    volumes:\n      - type: bind\n        source: ./site\n        target: /usr/share/nginx/html\n      - logs:/var/log\n",
+		},
+		{
+			name:     "depends_on lists merge with mappings",
+			base:     "services:\n  web:\n    depends_on: [db]\n",
+			override: "services:\n  web:\n    depends_on:\n      cache:\n        condition: service_healthy\n",
+			want:     "services:\n  web:\n    depends_on:\n      db:\n        condition: service_started\n      cache:\n        condition: service_healthy\n",
+		},
+		{
+			name:     "reset clears a value",
+			base:     "services:\n  web:\n    ports:\n      - 80:80\n    restart: always\n",
+			override: "services:\n  web:\n    ports: !reset []\n",
+			want:     "services:\n  web:\n    restart: always\n",
+		},
+		{
+			name:     "override replaces instead of merging",
+			base:     "services:\n  web:\n    labels:\n      a: 1\n",
+			override: "services:\n  web:\n    labels: !override\n      b: 2\n",
+			want:     "services:\n  web:\n    labels:\n      b: 2\n",
+		},
+		{
+			name:     "mappings outside services merge too",
+			base:     "networks:\n  front:\n    driver: bridge\n",
+			override: "networks:\n  front:\n    internal: true\n",
+			want:     "networks:\n  front:\n    driver: bridge\n    internal: true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := parseYAML(tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			override, err := parseYAML(tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatYAML(removeMergeTags(mergeComposeNode(nil, base, override))); got != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadComposeUploadedForm(t *testing.T) {
+	const compose = "# web server\nservices:\n  web:   {image: nginx:1.29}\n"
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"single/compose.yaml":               compose,
+		"merged/compose.yaml":               compose,
+		"merged/compose.override.yaml":      "services:\n  web:\n    restart: always\n",
+		"reformatted/compose.yaml":          "services:\n  web:\n    image: nginx:1.29 # pinned\n",
+		"reformatted/compose.override.yaml": "services:\n  web:\n    restart: always\n",
+	})
+	config := Config{RepoPath: dir}
+	load := func(project string) string {
+		t.Helper()
+		files, err := composeFilesFor(config, project, defaultProjectSettings(config, project))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := loadCompose(config, project, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+
+	if got := load("single"); got != compose {
+		t.Errorf("single file = %q, want it as written", got)
+	}
+	merged := load("merged")
+	if want := "services:\n  web:\n    image: nginx:1.29\n    restart: always\n"; merged != want {
+		t.Errorf("merged = %q, want %q", merged, want)
+	}
+	// Comments and layout aren't part of the merged upload
+	if got := load("reformatted"); got != merged {
+		t.Errorf("reformatted = %q, want %q", got, merged)
+	}
+}
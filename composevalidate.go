@@ -0,0 +1,620 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compose validation catches what would otherwise only fail once Arcane
+// deploys the project: each file is checked against the Compose
+// specification as it is written, then the merged project for references
+// between its parts.
+
+// fileProblem is something wrong at a line of a project file.
+type fileProblem struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (p *fileProblem) Error() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Msg)
+}
+
+// validateCompose checks a project's compose files, given relative to the
+// project folder. The project is nil if the files can't be parsed.
+func validateCompose(config Config, projectName string, files []string) (*composeProject, []error) {
+	project, err := parseComposeProject(config, projectName, files)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var problems []error
+	for _, source := range project.sources {
+		c := &composeChecker{file: source.file}
+		c.checkFile(source.doc)
+		sort.SliceStable(c.problems, func(i, j int) bool {
+			return c.problems[i].(*fileProblem).Line < c.problems[j].(*fileProblem).Line
+		})
+		problems = append(problems, c.problems...)
+	}
+	if len(problems) > 0 {
+		// Reference checks on a broken model only add noise
+		return project, problems
+	}
+	return project, checkComposeModel(project)
+}
+
+// checkCompose parses compose content about to be pushed, refusing content
+// that Arcane would fail to deploy unless COMPOSE_VALIDATION is off.
+func checkCompose(config Config, projectName string, content *ProjectContent) (*composeProject, error) {
+	if !config.ComposeValidation {
+		return parseComposeProject(config, projectName, content.ComposeFiles)
+	}
+	project, problems := validateCompose(config, projectName, content.ComposeFiles)
+	if len(problems) == 0 {
+		return project, nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Error()
+	}
+	return nil, fmt.Errorf("invalid compose file: %s", strings.Join(messages, "; "))
+}
+
+// Value types in the rules below. Values using interpolation ("${VAR}") are
+// only known once deployed, so they pass any type check.
+const (
+	composeString  = "string"
+	composeBool    = "bool"
+	composeNumber  = "number"
+	composeList    = "list"
+	composeMapping = "mapping"
+	composeListMap = "list or mapping"
+	composeStrList = "string or list"
+	composeStrMap  = "string or mapping"
+	composeScalar  = "string or number"
+	composeAny     = ""
+)
+
+// composeServiceKeys are the service attributes of the Compose specification
+// and the type each takes.
+var composeServiceKeys = map[string]string{
+	"annotations": composeListMap, "attach": composeBool, "blkio_config": composeMapping,
+	"build": composeStrMap, "cap_add": composeList, "cap_drop": composeList, "cgroup": composeString,
+	"cgroup_parent": composeString, "command": composeStrList, "configs": composeList,
+	"container_name": composeString, "cpu_count": composeNumber, "cpu_percent": composeNumber,
+	"cpu_period": composeScalar, "cpu_quota": composeScalar, "cpu_rt_period": composeScalar,
+	"cpu_rt_runtime": composeScalar, "cpu_shares": composeScalar, "cpus": composeScalar,
+	"cpuset": composeString, "credential_spec": composeMapping, "depends_on": composeListMap,
+	"deploy": composeMapping, "develop": composeMapping, "device_cgroup_rules": composeList,
+	"devices": composeList, "dns": composeStrList, "dns_opt": composeList, "dns_search": composeStrList,
+	"domainname": composeString, "driver_opts": composeMapping, "entrypoint": composeStrList,
+	"env_file": composeStrList, "environment": composeListMap, "expose": composeList,
+	"extends": composeStrMap, "external_links": composeList, "extra_hosts": composeListMap,
+	"gpus": composeAny, "group_add": composeList, "healthcheck": composeMapping, "hostname": composeString,
+	"image": composeString, "init": composeBool, "ipc": composeString, "isolation": composeString,
+	"label_file": composeStrList, "labels": composeListMap, "links": composeList, "logging": composeMapping,
+	"mac_address": composeString, "mem_limit": composeScalar, "mem_reservation": composeScalar,
+	"mem_swappiness": composeScalar, "memswap_limit": composeScalar, "models": composeListMap,
+	"network_mode": composeString, "networks": composeListMap, "oom_kill_disable": composeBool,
+	"oom_score_adj": composeScalar, "pid": composeString, "pids_limit": composeScalar,
+	"platform": composeString, "ports": composeList, "post_start": composeList, "pre_stop": composeList,
+	"privileged": composeBool, "profiles": composeList, "provider": composeMapping,
+	"pull_policy": composeString, "read_only": composeBool, "restart": composeString,
+	"runtime": composeString, "scale": composeScalar, "secrets": composeList,
+	"security_opt": composeList, "shm_size": composeScalar, "stdin_open": composeBool,
+	"stop_grace_period": composeString, "stop_signal": composeString, "storage_opt": composeMapping,
+	"sysctls": composeListMap, "tmpfs": composeStrList, "tty": composeBool, "ulimits": composeMapping,
+	"use_api_socket": composeBool, "user": composeString, "userns_mode": composeString,
+	"uts": composeString, "volumes": composeList, "volumes_from": composeList,
+	"working_dir": composeString,
+}
+
+// composeTopLevelKeys are the sections a compose file may have.
+var composeTopLevelKeys = []string{"version", "name", "include", "services", "networks", "volumes", "configs", "secrets", "models"}
+
+// composeResourceAttrs are the attributes of top-level networks, volumes,
+// configs and secrets.
+var composeResourceAttrs = map[string][]string{
+	"networks": {"driver", "driver_opts", "attachable", "enable_ipv4", "enable_ipv6", "external", "internal", "ipam", "labels", "name"},
+	"volumes":  {"driver", "driver_opts", "external", "labels", "name"},
+	"configs":  {"content", "environment", "external", "file", "labels", "name", "template_driver"},
+	"secrets":  {"driver", "driver_opts", "environment", "external", "file", "labels", "name", "template_driver"},
+	"models":   {"model", "context_size", "runtime_flags"},
+}
+
+var (
+	composeRestartPolicies = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:\d+)?)$`)
+	composePullPolicies    = regexp.MustCompile(`^(always|never|missing|if_not_present|build|daily|weekly|every_\w+|refresh)$`)
+	composeDependsOn       = []string{"service_started", "service_healthy", "service_completed_successfully"}
+	composeMountTypes      = []string{"volume", "bind", "tmpfs", "npipe", "cluster", "image"}
+	composeServiceName     = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	composePort            = regexp.MustCompile(`^((\[[0-9a-fA-F:.]+\]|\d+(\.\d+){3}):)?(\d*(-\d+)?:)?\d+(-\d+)?(/(tcp|udp|sctp))?$`)
+	composeVariableName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// composeChecker collects the problems in one compose file.
+type composeChecker struct {
+	file     string
+	problems []error
+}
+
+func (c *composeChecker) fail(line int, format string, args ...interface{}) {
+	c.problems = append(c.problems, &fileProblem{File: c.file, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *composeChecker) checkFile(doc *yamlNode) {
+	c.checkInterpolation("", doc)
+
+	for _, pair := range doc.Pairs {
+		if strings.HasPrefix(pair.Key, "x-") {
+			continue
+		}
+		if !slices.Contains(composeTopLevelKeys, pair.Key) {
+			c.fail(pair.Line, "unknown top-level key %q", pair.Key)
+			continue
+		}
+
+		value := pair.Value
+		switch pair.Key {
+		case "version", "name":
+			c.checkType(pair.Key, value, composeString)
+		case "include":
+			c.checkType(pair.Key, value, composeList)
+		case "services":
+			if c.checkType(pair.Key, value, composeMapping) {
+				for _, service := range value.Pairs {
+					c.checkService(service)
+				}
+			}
+		default:
+			if !c.checkType(pair.Key, value, composeMapping) {
+				continue
+			}
+			for _, resource := range value.Pairs {
+				c.checkResource(pair.Key, resource)
+			}
+		}
+	}
+}
+
+func (c *composeChecker) checkService(service yamlPair) {
+	where := "services." + service.Key
+	if !composeServiceName.MatchString(service.Key) {
+		c.fail(service.Line, "%s: service names may only contain letters, digits, '.', '_' and '-'", where)
+	}
+	if service.Value.Kind == yamlNull && service.Value.Tag == "" {
+		c.fail(service.Line, "%s: expected a mapping of service attributes", where)
+		return
+	}
+	if !c.checkType(where, service.Value, composeMapping) {
+		return
+	}
+
+	for _, attr := range service.Value.Pairs {
+		key := where + "." + attr.Key
+		kind, known := composeServiceKeys[attr.Key]
+		switch {
+		case strings.HasPrefix(attr.Key, "x-"):
+			continue
+		case !known:
+			c.fail(attr.Line, "%s: unknown service attribute", key)
+			continue
+		case !c.checkType(key, attr.Value, kind):
+			continue
+		}
+
+		value := attr.Value
+		switch attr.Key {
+		case "restart":
+			if !interpolated(value) && !composeRestartPolicies.MatchString(value.Value) {
+				c.fail(value.Line, "%s: expected no, always, on-failure[:retries] or unless-stopped, got %q", key, value.Value)
+			}
+		case "pull_policy":
+			if !interpolated(value) && !composePullPolicies.MatchString(value.Value) {
+				c.fail(value.Line, "%s: expected always, never, missing or build, got %q", key, value.Value)
+			}
+		case "ports":
+			c.checkPorts(key, value)
+		case "volumes":
+			c.checkVolumes(key, value)
+		case "depends_on":
+			c.checkDependsOn(key, value)
+		case "environment", "labels", "annotations", "sysctls":
+			c.checkKeyValues(key, value)
+		case "healthcheck":
+			if test := value.get("test"); test != nil {
+				c.checkType(key+".test", test, composeStrList)
+			}
+		case "logging":
+			if options := value.get("options"); options != nil {
+				c.checkType(key+".options", options, composeMapping)
+			}
+		}
+	}
+}
+
+func (c *composeChecker) checkPorts(key string, ports *yamlNode) {
+	for _, port := range ports.Items {
+		switch port.Kind {
+		case yamlScalar:
+			if !interpolated(port) && !composePort.MatchString(port.Value) {
+				c.fail(port.Line, "%s: invalid port %q, expected [host:]container[/protocol]", key, port.Value)
+			}
+		case yamlMapping:
+			if port.get("target") == nil {
+				c.fail(port.Line, "%s: target is required", key)
+			}
+		default:
+			c.fail(port.Line, "%s: expected a port, got %s", key, port.describe())
+		}
+	}
+}
+
+func (c *composeChecker) checkVolumes(key string, volumes *yamlNode) {
+	for _, volume := range volumes.Items {
+		switch volume.Kind {
+		case yamlScalar:
+			parts := strings.Split(volume.Value, ":")
+			if volume.Value == "" || len(parts) > 3 || slices.Contains(parts[:min(len(parts), 2)], "") {
+				c.fail(volume.Line, "%s: invalid volume %q, expected [source:]target[:mode]", key, volume.Value)
+			}
+		case yamlMapping:
+			mountType := volume.get("type")
+			switch {
+			case mountType == nil:
+				c.fail(volume.Line, "%s: type is required", key)
+			case !interpolated(mountType) && !slices.Contains(composeMountTypes, mountType.Value):
+				c.fail(mountType.Line, "%s: unknown volume type %q", key, mountType.Value)
+			}
+			if volume.get("target") == nil {
+				c.fail(volume.Line, "%s: target is required", key)
+			}
+			if mountType != nil && mountType.Value == "bind" && volume.get("source") == nil {
+				c.fail(volume.Line, "%s: source is required for a bind mount", key)
+			}
+		default:
+			c.fail(volume.Line, "%s: expected a volume, got %s", key, volume.describe())
+		}
+	}
+}
+
+func (c *composeChecker) checkDependsOn(key string, dependsOn *yamlNode) {
+	if dependsOn.Kind == yamlSequence {
+		for _, item := range dependsOn.Items {
+			c.checkType(key, item, composeString)
+		}
+		return
+	}
+	for _, dependency := range dependsOn.Pairs {
+		if dependency.Value.Kind != yamlMapping {
+			continue
+		}
+		condition := dependency.Value.get("condition")
+		if condition != nil && !interpolated(condition) && !slices.Contains(composeDependsOn, condition.Value) {
+			c.fail(condition.Line, "%s.%s.condition: expected %s, got %q", key, dependency.Key, strings.Join(composeDependsOn, ", "), condition.Value)
+		}
+	}
+}
+
+// checkKeyValues checks an environment-like attribute: KEY=VALUE strings or
+// a mapping of single values.
+func (c *composeChecker) checkKeyValues(key string, values *yamlNode) {
+	for _, item := range values.Items {
+		if item.Kind != yamlScalar || strings.HasPrefix(item.Value, "=") {
+			c.fail(item.Line, "%s: expected KEY=VALUE, got %s", key, item.describe())
+		}
+	}
+	for _, pair := range values.Pairs {
+		if pair.Value.Kind == yamlMapping || pair.Value.Kind == yamlSequence {
+			c.fail(pair.Line, "%s.%s: expected a single value, got %s", key, pair.Key, pair.Value.describe())
+		}
+	}
+}
+
+func (c *composeChecker) checkResource(section string, resource yamlPair) {
+	where := section + "." + resource.Key
+	if resource.Value.Kind == yamlNull {
+		return
+	}
+	if !c.checkType(where, resource.Value, composeMapping) {
+		return
+	}
+	for _, attr := range resource.Value.Pairs {
+		if !strings.HasPrefix(attr.Key, "x-") && !slices.Contains(composeResourceAttrs[section], attr.Key) {
+			c.fail(attr.Line, "%s.%s: unknown attribute", where, attr.Key)
+		}
+	}
+}
+
+// checkType reports a value of the wrong type, and whether the type was right.
+func (c *composeChecker) checkType(key string, value *yamlNode, kind string) bool {
+	if value.Tag == "!reset" || kind == composeAny {
+		return true
+	}
+
+	ok := false
+	switch value.Kind {
+	case yamlScalar:
+		switch kind {
+		case composeString, composeStrList, composeStrMap:
+			ok = true
+		case composeScalar:
+			ok = value.Quoted || !isYAMLBool(value)
+		case composeBool:
+			ok = !value.Quoted && isYAMLBool(value) || interpolated(value)
+		case composeNumber:
+			ok = !value.Quoted && isYAMLNumber(value.Value) || interpolated(value)
+		}
+	case yamlMapping:
+		ok = kind == composeMapping || kind == composeListMap || kind == composeStrMap
+	case yamlSequence:
+		ok = kind == composeList || kind == composeListMap || kind == composeStrList
+	case yamlNull:
+		// An empty value is as if it were left out
+		ok = true
+	}
+	if !ok {
+		c.fail(value.Line, "%s: expected %s, got %s", key, describeComposeType(kind), describeComposeValue(value))
+	}
+	return ok
+}
+
+func describeComposeType(kind string) string {
+	switch kind {
+	case composeBool:
+		return "true or false"
+	case composeList:
+		return "a list"
+	case composeMapping:
+		return "a mapping"
+	case composeString:
+		return "a string"
+	case composeNumber:
+		return "a number"
+	}
+	return "a " + kind
+}
+
+func describeComposeValue(value *yamlNode) string {
+	if value.Kind == yamlScalar {
+		return fmt.Sprintf("%q", value.Value)
+	}
+	return value.describe()
+}
+
+func interpolated(value *yamlNode) bool {
+	return value.Kind == yamlScalar && strings.Contains(value.Value, "$")
+}
+
+func isYAMLBool(value *yamlNode) bool {
+	switch value.Value {
+	case "true", "True", "TRUE", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+func isYAMLNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// checkInterpolation checks the ${VAR} syntax of every value in a document.
+func (c *composeChecker) checkInterpolation(key string, n *yamlNode) {
+	switch n.Kind {
+	case yamlScalar:
+		if msg := interpolationError(n.Value); msg != "" {
+			c.fail(n.Line, "%s: %s (write $$ for a literal $)", strings.TrimPrefix(key, "."), msg)
+		}
+	case yamlMapping:
+		for _, pair := range n.Pairs {
+			c.checkInterpolation(key+"."+pair.Key, pair.Value)
+		}
+	case yamlSequence:
+		for _, item := range n.Items {
+			c.checkInterpolation(key, item)
+		}
+	}
+}
+
+// interpolationError describes the first invalid substitution in s, the way
+// Compose parses them: $$, $VAR, ${VAR} and ${VAR<op>word} with :-, -, :?, ?,
+// :+ or +.
+func interpolationError(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			continue
+		}
+		rest := s[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			i++
+		case composeVariableName.MatchString(rest):
+			i += len(composeVariableName.FindString(rest))
+		case strings.HasPrefix(rest, "{"):
+			end := closingBrace(rest)
+			if end < 0 {
+				return fmt.Sprintf("unterminated ${ in %q", s)
+			}
+			expr := rest[1:end]
+			name := composeVariableName.FindString(expr)
+			if name == "" {
+				return fmt.Sprintf("invalid variable name in \"${%s}\"", expr)
+			}
+			if op := expr[len(name):]; op != "" {
+				modifier := ""
+				for _, candidate := range []string{":-", ":?", ":+", "-", "?", "+"} {
+					if strings.HasPrefix(op, candidate) {
+						modifier = candidate
+						break
+					}
+				}
+				if modifier == "" {
+					return fmt.Sprintf("invalid substitution \"${%s}\"", expr)
+				}
+				if msg := interpolationError(op[len(modifier):]); msg != "" {
+					return msg
+				}
+			}
+			i += end + 1
+		default:
+			return fmt.Sprintf("invalid interpolation in %q", s)
+		}
+	}
+	return ""
+}
+
+// closingBrace finds the brace closing the one s starts with, allowing nested
+// substitutions in default values.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// checkComposeModel checks the merged project: every service needs an image
+// to run, and whatever a service refers to must be defined.
+func checkComposeModel(project *composeProject) []error {
+	var problems []error
+	fail := func(keys []string, format string, args ...interface{}) {
+		file, line := project.locate(keys)
+		problems = append(problems, &fileProblem{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	model := project.model
+	services := model.get("services")
+	if services == nil || len(services.Pairs) == 0 {
+		fail(nil, "no services defined")
+		return problems
+	}
+
+	defined := func(section, name string) bool {
+		return model.get(section).get(name) != nil
+	}
+	for _, service := range services.Pairs {
+		where := "services." + service.Key
+		keys := []string{"services", service.Key}
+		attrs := service.Value
+		if attrs.get("image") == nil && attrs.get("build") == nil {
+			fail(keys, "%s: image or build is required", where)
+		}
+
+		for _, dependency := range referencedNames(attrs.get("depends_on")) {
+			if !defined("services", dependency) {
+				fail(append(keys, "depends_on"), "%s.depends_on: undefined service %q", where, dependency)
+			}
+		}
+		for _, network := range referencedNames(attrs.get("networks")) {
+			if network != "default" && !defined("networks", network) {
+				fail(append(keys, "networks"), "%s.networks: network %q is not defined under the top-level networks", where, network)
+			}
+		}
+		for _, section := range []string{"secrets", "configs"} {
+			for _, item := range listItems(attrs.get(section)) {
+				name := item.Value
+				if source := item.get("source"); source != nil {
+					name = source.Value
+				}
+				if name != "" && !defined(section, name) {
+					fail(append(keys, section), "%s.%s: %q is not defined under the top-level %s", where, section, name, section)
+				}
+			}
+		}
+		for _, volume := range listItems(attrs.get("volumes")) {
+			if name := namedVolume(volume); name != "" && !defined("volumes", name) {
+				fail(append(keys, "volumes"), "%s.volumes: volume %q is not defined under the top-level volumes", where, name)
+			}
+		}
+	}
+	return problems
+}
+
+// locate finds where a key path is first defined, or else the first file.
+func (p *composeProject) locate(keys []string) (string, int) {
+	for i := range p.sources {
+		node := p.sources[i].doc
+		line := node.Line
+		for _, key := range keys {
+			found := false
+			for _, pair := range node.Pairs {
+				if pair.Key == key {
+					node, line, found = pair.Value, pair.Line, true
+					break
+				}
+			}
+			if !found {
+				node = nil
+				break
+			}
+		}
+		if node != nil {
+			return p.sources[i].file, line
+		}
+	}
+	return p.sources[0].file, 1
+}
+
+// referencedNames lists the names in a list, or the keys of a mapping.
+func referencedNames(n *yamlNode) []string {
+	var names []string
+	for _, item := range listItems(n) {
+		if item.Kind == yamlScalar {
+			names = append(names, item.Value)
+		}
+	}
+	if n != nil {
+		for _, pair := range n.Pairs {
+			names = append(names, pair.Key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listItems(n *yamlNode) []*yamlNode {
+	if n == nil || n.Kind != yamlSequence {
+		return nil
+	}
+	return n.Items
+}
+
+// namedVolume returns the named volume a service mount uses, or "" for bind
+// mounts, anonymous volumes and other mount types.
+func namedVolume(n *yamlNode) string {
+	source := ""
+	switch n.Kind {
+	case yamlScalar:
+		parts := strings.Split(n.Value, ":")
+		if len(parts) < 2 {
+			return ""
+		}
+		source = parts[0]
+	case yamlMapping:
+		if mountType := n.get("type"); mountType == nil || mountType.Value != "volume" {
+			return ""
+		}
+		if s := n.get("source"); s != nil {
+			source = s.Value
+		}
+	}
+	if source == "" || strings.ContainsAny(source[:1], "./~$") {
+		return ""
+	}
+	return source
+}
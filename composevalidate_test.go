@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInterpolationError(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // "" when valid
+	}{
+		{"plain", ""},
+		{"$VAR", ""},
+		{"${VAR}", ""},
+		{"prefix-${VAR}-suffix", ""},
+		{"$$literal", ""},
+		{"$${NOT_A_VAR", ""},
+		{"${VAR:-default}", ""},
+		{"${VAR-default}", ""},
+		{"${VAR:?required}", ""},
+		{"${VAR?required}", ""},
+		{"${VAR:+set}", ""},
+		{"${VAR+set}", ""},
+		{"${VAR:-${OTHER:-nested}}", ""},
+		{"${VAR:-}", ""},
+		{"${_UNDER_9}", ""},
+
+		{"${VAR", `unterminated ${ in "${VAR"`},
+		{"${}", `invalid variable name in "${}"`},
+		{"${9VAR}", `invalid variable name in "${9VAR}"`},
+		{"${VAR:default}", `invalid substitution "${VAR:default}"`},
+		{"${VAR/x/y}", `invalid substitution "${VAR/x/y}"`},
+		{"${VAR:-${9}}", `invalid variable name in "${9}"`},
+		{"cost: 5$", `invalid interpolation in "cost: 5$"`},
+		{"a $ b", `invalid interpolation in "a $ b"`},
+	}
+	for _, tt := range tests {
+		if got := interpolationError(tt.in); got != tt.want {
+			t.Errorf("interpolationError(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateComposeInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"web/compose.yaml": `services:
+  web:
+    image: nginx:${TAG:-1.29}
+    environment:
+      PRICE: 5$
+      GOOD: $$5
+    command: ["echo", "${MSG"]
+`,
+	})
+
+	_, problems := validateCompose(Config{RepoPath: dir}, "web", []string{"compose.yaml"})
+	want := []fileProblem{
+		{File: "web/compose.yaml", Line: 5, Msg: `services.web.environment.PRICE: invalid interpolation in "5$" (write $$ for a literal $)`},
+		{File: "web/compose.yaml", Line: 7, Msg: `services.web.command: unterminated ${ in "${MSG" (write $$ for a literal $)`},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("validateCompose = %v, want %d problems", problems, len(want))
+	}
+	for i, err := range problems {
+		var problem *fileProblem
+		if !errors.As(err, &problem) || *problem != want[i] {
+			t.Errorf("problem %d = %v, want %v", i, err, &want[i])
+		}
+	}
+}
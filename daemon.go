@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// daemon keeps the process alive and runs sync passes on a schedule. All
+// passes run on a single goroutine, so two passes can never overlap.
+type daemon struct {
+	config Config
+	client *arcane.Client
+
+	// triggers requests an immediate pass (e.g. from a webhook). It holds at
+	// most one pending request, so triggers arriving mid-pass coalesce.
+	triggers chan struct{}
+}
+
+func runDaemon(args []string) int {
+	fs := newFlagSet("daemon")
+	fs.Usage = func() { commandUsage(fs, "daemon") }
+	if _, err := parseCommandFlags(fs, args); err != nil {
+		return flagExitCode(err)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	setupLogging(config.LogFile)
+	if err := setupGitAuth(context.Background(), config); err != nil {
+		logError(fmt.Sprintf("Git authentication setup failed: %v", err))
+		return exitError
+	}
+
+	d := &daemon{
+		config:   config,
+		client:   newArcaneClient(config),
+		triggers: make(chan struct{}, 1),
+	}
+	d.run()
+	return exitOK
+}
+
+func (d *daemon) run() {
+	// ctx is cancelled on SIGTERM/SIGINT; runSync finishes the project it is
+	// working on and then returns.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	reloads := make(chan struct{}, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				select {
+				case reloads <- struct{}{}:
+				default: // A reload is already pending
+				}
+				continue
+			}
+			logInfo(fmt.Sprintf("Received %s, stopping after the current project", sig))
+			stop()
+			return
+		}
+	}()
+
+	logInfo(fmt.Sprintf("Starting daemon (interval %s, jitter up to %s)", d.config.SyncInterval, d.config.SyncJitter))
+
+	// The listener address and secret are fixed for the life of the process
+	if d.config.WebhookListen != "" {
+		newWebhookServer(d.config, d.requestSync).start(ctx, d.config.WebhookListen)
+	}
+
+	// Run the first pass right away
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo("Daemon stopped")
+			return
+		case <-reloads:
+			// The new interval applies from the next scheduled pass on
+			d.reload(ctx)
+			continue
+		case <-timer.C:
+			d.syncOnce(ctx)
+		case <-d.triggers:
+			d.syncOnce(ctx)
+		}
+
+		// A webhook pass may have run while the interval fired; drop the stale
+		// tick so it doesn't start another pass right away
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		next := d.nextDelay()
+		timer.Reset(next)
+		if ctx.Err() == nil {
+			logInfo(fmt.Sprintf("Next sync in %s", next.Round(time.Second)))
+		}
+	}
+}
+
+// requestSync asks for a pass as soon as the current one (if any) finishes.
+func (d *daemon) requestSync() {
+	select {
+	case d.triggers <- struct{}{}:
+	default: // A pass is already pending
+	}
+}
+
+func (d *daemon) syncOnce(ctx context.Context) {
+	started := time.Now()
+	err := runSync(ctx, d.config, d.client)
+	switch {
+	case errors.Is(err, errSyncInterrupted):
+		logWarning(fmt.Sprintf("Sync pass interrupted: %v", err))
+	case err != nil:
+		logError(fmt.Sprintf("Sync failed: %v", err))
+	}
+	logInfo(fmt.Sprintf("Sync pass took %s", time.Since(started).Round(time.Millisecond)))
+}
+
+// reload re-reads the config file. An invalid config is rejected and the
+// daemon keeps running with the previous one.
+func (d *daemon) reload(ctx context.Context) {
+	logInfo("Received SIGHUP, reloading configuration")
+
+	config, err := reloadConfig()
+	if err != nil {
+		logError(fmt.Sprintf("Failed to reload configuration, keeping the current one: %v", err))
+		return
+	}
+	if err := setupGitAuth(ctx, config); err != nil {
+		logError(fmt.Sprintf("Failed to reload configuration, keeping the current one: %v", err))
+		if err := setupGitAuth(ctx, d.config); err != nil {
+			logError(fmt.Sprintf("Git authentication setup failed: %v", err))
+		}
+		return
+	}
+	if config.LogFile != d.config.LogFile {
+		logWarning("LOG_FILE changes take effect after a restart")
+	}
+	if config.WebhookListen != d.config.WebhookListen || config.WebhookSecret != d.config.WebhookSecret || config.WebhookDebounce != d.config.WebhookDebounce {
+		logWarning("WEBHOOK_* changes take effect after a restart")
+	}
+
+	// Clients share one http.Client, so the pooled connections survive this
+	d.client = newArcaneClient(config)
+
+	d.config = config
+	logSuccess("Configuration reloaded")
+}
+
+// nextDelay spreads passes out so several hosts sharing a repo don't hit the
+// git remote and Arcane in lockstep.
+func (d *daemon) nextDelay() time.Duration {
+	delay := d.config.SyncInterval
+	if d.config.SyncJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(d.config.SyncJitter)))
+	}
+	return delay
+}
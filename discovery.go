@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listDiskProjects finds the project folders (see isProjectFolder) up to
+// PROJECTS_DEPTH levels below PROJECTS_DIR. Everything inside a project folder
+// belongs to it, so the search doesn't descend into one.
+//
+// A project is identified by its folder's path in the repository, such as
+// "apps/media/jellyfin"; the sync state, the git diff and the commands all use
+// that path.
+func listDiskProjects(config Config) ([]string, error) {
+	rules, err := loadIgnoreRules(config)
+	if err != nil {
+		return nil, err
+	}
+	return scanDiskProjects(config, rules)
+}
+
+// scanDiskProjects is listDiskProjects with the ignore rules already loaded.
+func scanDiskProjects(config Config, rules *ignoreRules) ([]string, error) {
+	var projects []string
+
+	var scan func(dir string, depth int) error
+	scan = func(dir string, depth int) error {
+		entries, err := os.ReadDir(filepath.Join(config.RepoPath, filepath.FromSlash(dir)))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			if !entry.IsDir() || rules.excludes(name) {
+				continue
+			}
+
+			if isProjectFolder(filepath.Join(config.RepoPath, filepath.FromSlash(name))) {
+				projects = append(projects, name)
+			} else if depth > 1 {
+				if err := scan(name, depth-1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := scan(config.ProjectsDir, config.ProjectsDepth); err != nil {
+		return nil, fmt.Errorf("failed to read projects directory: %w", err)
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// isProjectFolder reports whether a folder holds a project: a compose file,
+// or a settings file that may name other compose files.
+func isProjectFolder(dir string) bool {
+	if findComposeFile(dir) != "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, projectSettingsFile))
+	return err == nil
+}
+
+// projectForFile returns the project a repository file belongs to, and the
+// file's path within the project folder.
+func projectForFile(projects []string, file string) (string, string, bool) {
+	for _, name := range projects {
+		if relPath, found := strings.CutPrefix(file, name+"/"); found {
+			return name, relPath, true
+		}
+	}
+	return "", "", false
+}
+
+// projectPath is a project's path below PROJECTS_DIR.
+func projectPath(config Config, projectName string) string {
+	if config.ProjectsDir == "" {
+		return projectName
+	}
+	return strings.TrimPrefix(projectName, config.ProjectsDir+"/")
+}
+
+// defaultArcaneName is the Arcane project name of a folder without a name
+// setting: its path below PROJECTS_DIR with dashes for slashes, so
+// "media/jellyfin" deploys as "media-jellyfin".
+func defaultArcaneName(config Config, projectName string) string {
+	return strings.ReplaceAll(projectPath(config, projectName), "/", "-")
+}
+
+// cleanProjectsDir normalizes PROJECTS_DIR to a slash-separated path relative
+// to the repository, "" being the repository itself.
+func cleanProjectsDir(dir string) string {
+	dir = path.Clean(filepath.ToSlash(strings.TrimSpace(dir)))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+func validateProjectsDir(config Config) error {
+	if path.IsAbs(config.ProjectsDir) || config.ProjectsDir == ".." || strings.HasPrefix(config.ProjectsDir, "../") {
+		return errors.New("PROJECTS_DIR must be a subdirectory of COMPOSE_REPO_PATH")
+	}
+	if config.ProjectsDepth < 1 {
+		return errors.New("PROJECTS_DEPTH must be at least 1")
+	}
+	return nil
+}
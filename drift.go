@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+const (
+	driftPolicyOff     = "off"
+	driftPolicyReport  = "report"
+	driftPolicyReapply = "reapply"
+)
+
+func isValidDriftPolicy(policy string) bool {
+	switch policy {
+	case driftPolicyOff, driftPolicyReport, driftPolicyReapply:
+		return true
+	}
+	return false
+}
+
+// detectDrift returns which parts of a project ("compose", "env") differ
+// between disk and what Arcane reports.
+func detectDrift(content *ProjectContent, project arcane.Project) []string {
+	var drifted []string
+
+	// Older Arcane versions don't include content in the list response;
+	// an empty compose means "unknown", not "drifted".
+	if project.ComposeContent == "" {
+		return nil
+	}
+
+	if normalizeContent(content.Compose) != normalizeContent(project.ComposeContent) {
+		drifted = append(drifted, "compose")
+	}
+	if normalizeContent(content.Env) != normalizeContent(project.EnvContent) {
+		drifted = append(drifted, "env")
+	}
+	return drifted
+}
+
+// normalizeContent ignores line ending and trailing whitespace differences
+// that Arcane may introduce when storing content.
+func normalizeContent(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// planDrift applies the drift policy to a project. It returns the reason to
+// re-apply it from disk, or "" when nothing should be done.
+func planDrift(policy, projectName string, content *ProjectContent, project arcane.Project, plan *SyncPlan) string {
+	if policy == driftPolicyOff {
+		return ""
+	}
+
+	drifted := detectDrift(content, project)
+	if len(drifted) == 0 {
+		return ""
+	}
+
+	what := strings.Join(drifted, " and ")
+	if policy == driftPolicyReapply {
+		return fmt.Sprintf("drifted from git (%s differs in Arcane)", what)
+	}
+
+	plan.warn(projectName, fmt.Sprintf("Project %s has drifted from git (%s differs in Arcane); set DRIFT_POLICY=reapply to correct it", projectName, what))
+	return ""
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+func TestDetectDrift(t *testing.T) {
+	content := &ProjectContent{Compose: testCompose, Env: "A=1\n"}
+	tests := []struct {
+		name    string
+		compose string
+		env     string
+		want    string
+	}{
+		{"same", testCompose, "A=1\n", ""},
+		{"line endings and trailing whitespace", strings.ReplaceAll(testCompose, "\n", "  \r\n"), "A=1", ""},
+		{"content unknown", "", "", ""},
+		{"compose", testCompose + "  db:\n    image: postgres:16\n", "A=1\n", "compose"},
+		{"env", testCompose, "A=2\n", "env"},
+		{"env cleared", testCompose, "", "env"},
+		{"both", "services: {}\n", "", "compose and env"},
+	}
+	for _, tt := range tests {
+		drifted := detectDrift(content, arcane.Project{ComposeContent: tt.compose, EnvContent: tt.env})
+		if got := strings.Join(drifted, " and "); got != tt.want {
+			t.Errorf("%s: detectDrift = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A project without env files matches an empty env in Arcane
+	if drifted := detectDrift(&ProjectContent{Compose: testCompose}, arcane.Project{ComposeContent: testCompose}); len(drifted) > 0 {
+		t.Errorf("no env: detectDrift = %q, want nothing", drifted)
+	}
+}
+
+func TestPlanDrift(t *testing.T) {
+	content := &ProjectContent{Compose: testCompose}
+	drifted := arcane.Project{ComposeContent: "services: {}\n"}
+	tests := []struct {
+		policy  string
+		project arcane.Project
+		reason  string
+		warning bool
+	}{
+		{driftPolicyOff, drifted, "", false},
+		{driftPolicyReport, drifted, "", true},
+		{driftPolicyReapply, drifted, "drifted from git (compose differs in Arcane)", false},
+		{driftPolicyReapply, arcane.Project{ComposeContent: testCompose}, "", false},
+	}
+	for _, tt := range tests {
+		plan := &SyncPlan{}
+		if reason := planDrift(tt.policy, "web", content, tt.project, plan); reason != tt.reason {
+			t.Errorf("%s: reason = %q, want %q", tt.policy, reason, tt.reason)
+		}
+		if warned := len(plan.Warnings) > 0; warned != tt.warning {
+			t.Errorf("%s: warnings = %v, want a warning: %v", tt.policy, plan.Warnings, tt.warning)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Env files at the repository root, layered around each project's own. From
+// lowest to highest precedence: .env.global, .env.local (host-local, never
+// committed), the project's .env and encrypted env files, and .env.env-<id>
+// for the Arcane environment the project deploys to.
+const (
+	globalEnvFile = ".env.global"
+	localEnvFile  = ".env.local"
+)
+
+// environmentEnvFile names the root env file overriding the variables of the
+// projects deployed to an environment. The prefix keeps an environment named
+// "global" or "local" from taking the other layers' files.
+func environmentEnvFile(envID string) string {
+	return ".env.env-" + envID
+}
+
+// envSource is an env file's content, as uploaded. File is relative to the
+// repository root.
+type envSource struct {
+	file      string
+	content   string
+	encrypted bool // Left encrypted (SkipDecrypt), so content is empty
+}
+
+// readProjectEnv reads the env layers of a project deployed to envID, lowest
+// precedence first. Every layer is optional.
+func readProjectEnv(ctx context.Context, config Config, projectName, envID string) ([]envSource, error) {
+	var sources []envSource
+	read := func(relPath string) error {
+		data, err := os.ReadFile(filepath.Join(config.RepoPath, filepath.FromSlash(relPath)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+		sources = append(sources, envSource{file: relPath, content: string(data)})
+		return nil
+	}
+
+	for _, file := range []string{globalEnvFile, localEnvFile, path.Join(projectName, ".env")} {
+		if err := read(file); err != nil {
+			return nil, err
+		}
+	}
+	encrypted, err := readEncryptedEnv(ctx, config, projectName)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, encrypted...)
+
+	// An ID that isn't a plain name can't have a file
+	if envID != "" && !strings.ContainsAny(envID, `/\`) && envID != "." && envID != ".." {
+		if err := read(environmentEnvFile(envID)); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// envVariable is a variable's effective definition across the env layers.
+type envVariable struct {
+	Key       string   `json:"key"`
+	Value     string   `json:"value,omitempty"`
+	Source    string   `json:"source"`              // File the effective definition is in
+	Overrides []string `json:"overrides,omitempty"` // Files with definitions it replaces
+	line      string   // The definition as written
+}
+
+// envEntry is a definition in an env file.
+type envEntry struct {
+	key   string
+	value string // As written, quotes included
+	text  string // The whole definition, over several lines for a quoted value with line breaks
+}
+
+// parseEnvFile splits an env file into its definitions. A quoted value runs
+// to its closing quote, so it may span lines; a line that isn't KEY=VALUE,
+// or a quote left open, is a problem.
+func parseEnvFile(source envSource) ([]envEntry, []error) {
+	var entries []envEntry
+	var problems []error
+	lines := strings.Split(source.content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		if !found || key == "" {
+			problems = append(problems, &fileProblem{File: source.file, Line: i + 1, Msg: "expected KEY=VALUE"})
+			continue
+		}
+
+		start := i
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+			for quoteEnd(value) < 0 {
+				if i+1 == len(lines) {
+					// The rest of the file would be the value
+					return entries, append(problems, &fileProblem{File: source.file, Line: start + 1, Msg: key + ": unclosed quote"})
+				}
+				i++
+				value += "\n" + lines[i]
+			}
+		}
+		entries = append(entries, envEntry{key: key, value: strings.TrimSpace(value), text: strings.TrimSpace(strings.Join(lines[start:i+1], "\n"))})
+	}
+	return entries, problems
+}
+
+// quoteEnd returns where the quote a value starts with closes, or -1. In
+// double quotes, a backslash escapes the next character.
+func quoteEnd(value string) int {
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveEnv merges env layers: each variable keeps the place of its first
+// definition and takes the value of its last.
+func resolveEnv(sources []envSource) ([]envVariable, error) {
+	var variables []envVariable
+	index := make(map[string]int)
+	for _, source := range sources {
+		entries, problems := parseEnvFile(source)
+		if len(problems) > 0 {
+			return nil, problems[0]
+		}
+		for _, entry := range entries {
+			i, seen := index[entry.key]
+			if !seen {
+				index[entry.key] = len(variables)
+				variables = append(variables, envVariable{Key: entry.key})
+				i = len(variables) - 1
+			}
+			v := &variables[i]
+			if seen && v.Source != source.file && !slices.Contains(v.Overrides, v.Source) {
+				v.Overrides = append(v.Overrides, v.Source)
+			}
+			v.Value, v.Source, v.line = entry.value, source.file, entry.text
+		}
+	}
+	return variables, nil
+}
+
+// renderEnv produces the env content uploaded to Arcane. A single env file
+// is uploaded exactly as written; layers are merged into one definition per
+// variable.
+func renderEnv(sources []envSource) (string, error) {
+	switch len(sources) {
+	case 0:
+		return "", nil
+	case 1:
+		return sources[0].content, nil
+	}
+	variables, err := resolveEnv(sources)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, v := range variables {
+		b.WriteString(v.line)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// runEnvCommand shows a project's effective env and which file each variable
+// comes from. Values are masked unless asked for, as they are often secrets.
+func runEnvCommand(args []string) int {
+	fs := newFlagSet("env")
+	jsonOutput := fs.Bool("json", false, "print the variables as JSON")
+	showValues := fs.Bool("values", false, "print values instead of masking them")
+	fs.Usage = func() { commandUsage(fs, "env") }
+	positional, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "env takes exactly one project name")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return exitUsage
+	}
+	name := positional[0]
+
+	config, err := buildConfig()
+	if err == nil && config.RepoPath == "" {
+		err = errors.New("COMPOSE_REPO_PATH environment variable is required")
+	}
+	if err == nil {
+		err = validateProjectsDir(config)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	// Read-only: stay out of the sync log
+	log.SetOutput(io.Discard)
+	consoleOutput = os.Stderr
+
+	projects, err := listDiskProjects(config)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to list disk projects: %v", err))
+		return exitError
+	}
+	if !slices.Contains(projects, name) {
+		logError(fmt.Sprintf("No project %s in %s", name, config.RepoPath))
+		return exitError
+	}
+	settings, err := loadProjectSettings(config, name)
+	if err != nil {
+		logError(fmt.Sprintf("Invalid settings for project %s: %v", name, err))
+		return exitError
+	}
+	sources, err := readProjectEnv(context.Background(), config, name, settings.EnvID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to read the env of project %s: %v", name, err))
+		return exitError
+	}
+
+	variables, err := resolveEnv(sources)
+	if err != nil {
+		logError(fmt.Sprintf("Invalid env for project %s: %v", name, err))
+		return exitError
+	}
+	if !*showValues {
+		for i := range variables {
+			variables[i].Value = ""
+		}
+	}
+	if *jsonOutput {
+		files := make([]string, len(sources))
+		for i, source := range sources {
+			files[i] = source.file
+		}
+		return printJSON(struct {
+			Project     string        `json:"project"`
+			Environment string        `json:"environment"`
+			Files       []string      `json:"files"`
+			Variables   []envVariable `json:"variables"`
+		}{name, settings.EnvID, files, variables})
+	}
+
+	fmt.Printf("Project: %s (Arcane environment %s)\n", name, settings.EnvID)
+	if len(sources) == 0 {
+		fmt.Println("No env files.")
+		return exitOK
+	}
+	fmt.Println("Files, lowest precedence first:")
+	for _, source := range sources {
+		fmt.Printf("  %s\n", source.file)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tOVERRIDES")
+	for _, v := range variables {
+		value := "********"
+		if *showValues {
+			// Keep a multi-line value on its row
+			value = strings.ReplaceAll(v.Value, "\n", `\n`)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Key, value, v.Source, orDash(strings.Join(v.Overrides, ", ")))
+	}
+	w.Flush()
+	return exitOK
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadProjectEnvLayerOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env.global":      "A=global\n",
+		".env.local":       "A=local\n",
+		"web/.env":         "A=project\n",
+		".env.env-2":       "A=environment\n",
+		".env.env-3":       "A=other environment\n",
+		"web/compose.yaml": "services: {}\n",
+	})
+
+	sources, err := readProjectEnv(context.Background(), Config{RepoPath: dir}, "web", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, source := range sources {
+		files = append(files, source.file)
+	}
+	if want := []string{".env.global", ".env.local", "web/.env", ".env.env-2"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("layers = %v, want %v", files, want)
+	}
+
+	// An environment named like another layer doesn't read that layer twice
+	for _, envID := range []string{"global", "local", "../web", ""} {
+		sources, err := readProjectEnv(context.Background(), Config{RepoPath: dir}, "web", envID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sources) != 3 {
+			t.Errorf("environment %q: %d layers, want 3", envID, len(sources))
+		}
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	sources := []envSource{
+		{file: ".env.global", content: "TZ=UTC\nDOMAIN=example.com\nexport PUID=1000\n"},
+		{file: ".env.local", content: "# host-local\nTZ=Europe/Berlin\n"},
+		{file: "web/.env", content: "DOMAIN=web.example.com\nPUID = 1001\n\nTZ=Asia/Tokyo\n"},
+		{file: ".env.env-2", content: "DOMAIN=web.prod.example.com\n"},
+	}
+	variables, err := resolveEnv(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []envVariable{
+		{Key: "TZ", Value: "Asia/Tokyo", Source: "web/.env", Overrides: []string{".env.global", ".env.local"}, line: "TZ=Asia/Tokyo"},
+		{Key: "DOMAIN", Value: "web.prod.example.com", Source: ".env.env-2", Overrides: []string{".env.global", "web/.env"}, line: "DOMAIN=web.prod.example.com"},
+		{Key: "PUID", Value: "1001", Source: "web/.env", Overrides: []string{".env.global"}, line: "PUID = 1001"},
+	}
+	if !reflect.DeepEqual(variables, want) {
+		t.Errorf("resolveEnv =\n%+v\nwant\n%+v", variables, want)
+	}
+
+	rendered, err := renderEnv(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "TZ=Asia/Tokyo\nDOMAIN=web.prod.example.com\nPUID = 1001\n"; rendered != want {
+		t.Errorf("renderEnv = %q, want %q", rendered, want)
+	}
+}
+
+func TestRenderEnvSingleFileAsWritten(t *testing.T) {
+	content := "# comment\nA=1\n\nB='two\nlines'\n"
+	rendered, err := renderEnv([]envSource{{file: "web/.env", content: content}})
+	if err != nil || rendered != content {
+		t.Errorf("renderEnv = %q, %v, want %q", rendered, err, content)
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     []envEntry
+		problems []string
+	}{
+		{
+			name:    "plain",
+			content: "A=1\n  B = two words \nexport C=3\nD=\n",
+			want: []envEntry{
+				{key: "A", value: "1", text: "A=1"},
+				{key: "B", value: "two words", text: "B = two words"},
+				{key: "C", value: "3", text: "export C=3"},
+				{key: "D", value: "", text: "D="},
+			},
+		},
+		{
+			name:    "quoted values span lines",
+			content: "CERT=\"-----BEGIN-----\nabc\n-----END-----\"\nKEY='a\n\nb'\nNEXT=1\n",
+			want: []envEntry{
+				{key: "CERT", value: "\"-----BEGIN-----\nabc\n-----END-----\"", text: "CERT=\"-----BEGIN-----\nabc\n-----END-----\""},
+				{key: "KEY", value: "'a\n\nb'", text: "KEY='a\n\nb'"},
+				{key: "NEXT", value: "1", text: "NEXT=1"},
+			},
+		},
+		{
+			name:    "escaped quotes",
+			content: "A=\"say \\\"hi\\\"\"\nB='it\\'\nC=1\n",
+			want: []envEntry{
+				{key: "A", value: `"say \"hi\""`, text: `A="say \"hi\""`},
+				{key: "B", value: `'it\'`, text: `B='it\'`},
+				{key: "C", value: "1", text: "C=1"},
+			},
+		},
+		{
+			name:     "not KEY=VALUE",
+			content:  "A=1\njust text\n=value\nB=2\n",
+			want:     []envEntry{{key: "A", value: "1", text: "A=1"}, {key: "B", value: "2", text: "B=2"}},
+			problems: []string{"web/.env:2: expected KEY=VALUE", "web/.env:3: expected KEY=VALUE"},
+		},
+		{
+			name:     "unclosed quote",
+			content:  "A=1\nB=\"open\nC=3\n",
+			want:     []envEntry{{key: "A", value: "1", text: "A=1"}},
+			problems: []string{"web/.env:2: B: unclosed quote"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, problems := parseEnvFile(envSource{file: "web/.env", content: tt.content})
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("entries =\n%+v\nwant\n%+v", entries, tt.want)
+			}
+			var got []string
+			for _, problem := range problems {
+				got = append(got, problem.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.problems, "\n") {
+				t.Errorf("problems = %q, want %q", got, tt.problems)
+			}
+		})
+	}
+}
+
+func TestResolveEnvUnclosedQuote(t *testing.T) {
+	_, err := resolveEnv([]envSource{
+		{file: ".env.global", content: "A=1\n"},
+		{file: "web/.env", content: "B='open\n"},
+	})
+	if err == nil || err.Error() != "web/.env:1: B: unclosed quote" {
+		t.Errorf("resolveEnv = %v, want the unclosed quote", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// PathFilter decides which files inside a project folder count as part of the
+// project. An empty include list means "everything"; excludes always win.
+type PathFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Matches reports whether a slash-separated path relative to the project
+// folder is selected by the filter.
+func (f PathFilter) Matches(relPath string) bool {
+	for _, pattern := range f.Exclude {
+		if matchPathPattern(pattern, relPath) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchPathPattern(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern supports three pattern shapes:
+//   - "config/" matches everything below a directory
+//   - "*.conf" (no slash) matches any path segment, like .gitignore
+//   - "nginx/*.conf" matches the path, or any of its leading directories
+func matchPathPattern(pattern, relPath string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(pattern, "/")
+		return relPath == dir || strings.HasPrefix(relPath, dir+"/") || matchPathPattern(dir, relPath)
+	}
+
+	segments := strings.Split(relPath, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := len(segments); i > 0; i-- {
+		if ok, _ := path.Match(pattern, strings.Join(segments[:i], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// composeFilePatterns match compose files by their usual names, overrides
+// such as compose.prod.yaml included.
+var composeFilePatterns = []string{"compose.yaml", "compose.yml", "compose.*.yaml", "compose.*.yml",
+	"docker-compose.yaml", "docker-compose.yml", "docker-compose.*.yaml", "docker-compose.*.yml"}
+
+// isProjectPayloadFile reports whether a project-relative path is content that
+// is uploaded to Arcane itself and therefore always triggers a sync.
+func isProjectPayloadFile(relPath string) bool {
+	if relPath == ".env" || isEncryptedEnvFile(relPath) {
+		return true
+	}
+	for _, pattern := range composeFilePatterns {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
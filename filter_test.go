@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// A trailing slash matches everything below a directory
+		{"config/", "config", true},
+		{"config/", "config/nginx.conf", true},
+		{"config/", "config/sites/default.conf", true},
+		{"config/", "configs/nginx.conf", false},
+		{"config/", "app/config/nginx.conf", true},
+
+		// No slash: any path segment
+		{"*.conf", "nginx.conf", true},
+		{"*.conf", "config/nginx.conf", true},
+		{"*.conf", "nginx.conf.bak", false},
+		{"Dockerfile", "build/Dockerfile", true},
+		{"Dockerfile", "Dockerfile.dev", false},
+
+		// With a slash: the path or one of its leading directories
+		{"nginx/*.conf", "nginx/default.conf", true},
+		{"nginx/*.conf", "nginx/sub/default.conf", false},
+		{"nginx/*.conf", "other/nginx/default.conf", false},
+		{"nginx/sites", "nginx/sites/default.conf", true},
+
+		// Blank patterns match nothing
+		{"", "anything", false},
+		{"  ", "anything", false},
+		{" *.conf ", "nginx.conf", true},
+	}
+	for _, tt := range tests {
+		if got := matchPathPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathFilterMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter PathFilter
+		path   string
+		want   bool
+	}{
+		{"empty filter selects everything", PathFilter{}, "data/cache.db", true},
+		{"include", PathFilter{Include: []string{"*.conf"}}, "nginx.conf", true},
+		{"not included", PathFilter{Include: []string{"*.conf"}}, "README.md", false},
+		{"exclude", PathFilter{Exclude: []string{"data/"}}, "data/cache.db", false},
+		{"exclude wins over include", PathFilter{Include: []string{"*.conf"}, Exclude: []string{"local.conf"}}, "local.conf", false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(tt.path); got != tt.want {
+			t.Errorf("%s: Matches(%q) = %v, want %v", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment passed to this binary when git runs it as GIT_ASKPASS. The
+// credentials travel in the environment of the git commands only, which
+// unlike process arguments is not visible to other users in ps, and nothing
+// is written to .git/config.
+const (
+	askpassEnv         = "ARCANE_GITOPS_ASKPASS"
+	askpassUserEnv     = "ARCANE_GITOPS_GIT_USERNAME"
+	askpassPasswordEnv = "ARCANE_GITOPS_GIT_PASSWORD"
+)
+
+// gitAuthEnv holds the variables setupGitAuth chose for the git commands we
+// run. They are added to each git command's environment and never set in our
+// own. A config reload sets them up again while syncs may be running git, so
+// they are only accessed with gitAuthMu held.
+var (
+	gitAuthMu  sync.Mutex
+	gitAuthEnv = make(map[string]string)
+	// gitKnownHostsFile is the known_hosts file GIT_SSH_COMMAND uses, for
+	// error messages
+	gitKnownHostsFile string
+)
+
+// credentialEnv are settings holding credentials. A config file puts them in
+// our environment, but no command we run gets them: git authenticates through
+// askpass, and other commands such as sops or ssh-keyscan have no use for them.
+var credentialEnv = []string{"ARCANE_API_KEY", "GIT_HTTPS_TOKEN", "GIT_HTTPS_USERNAME", "WEBHOOK_SECRET"}
+
+// setupGitAuth configures the environment of the git commands we run. It
+// fails only when the remote can't be trusted, e.g. a pinned SSH host key
+// doesn't match.
+func setupGitAuth(ctx context.Context, config Config) error {
+	resetGitAuthEnv()
+
+	switch authMethod := strings.ToLower(config.GitAuthMethod); authMethod {
+	case "ssh":
+		return setupGitSSH(ctx, config)
+	case "https":
+		setupGitHTTPS(ctx, config)
+	case "none":
+		// Public repository, or credentials configured outside arcane-gitops
+	default:
+		logWarning(fmt.Sprintf("Unknown git auth method: %s, defaulting to SSH", authMethod))
+		return setupGitSSH(ctx, config)
+	}
+	return nil
+}
+
+func setupGitSSH(ctx context.Context, config Config) error {
+	sshCommand := []string{"ssh"}
+
+	// Without a key, ssh falls back to its usual identities
+	keyPath := config.GitSSHKeyPath
+	if keyPath != "" {
+		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+			logWarning(fmt.Sprintf("SSH key not found at %s, git operations may fail", keyPath))
+		} else {
+			sshCommand = append(sshCommand, "-i", shellQuote(keyPath))
+		}
+	}
+
+	strictHostKeyChecking, err := prepareKnownHosts(ctx, config)
+	if err != nil {
+		return err
+	}
+	sshCommand = append(sshCommand,
+		"-o", shellQuote(`UserKnownHostsFile="`+config.GitKnownHosts+`"`),
+		"-o", "StrictHostKeyChecking="+strictHostKeyChecking)
+
+	// GIT_SSH_COMMAND is run through the shell
+	setGitEnv("GIT_SSH_COMMAND", strings.Join(sshCommand, " "))
+	gitAuthMu.Lock()
+	gitKnownHostsFile = config.GitKnownHosts
+	gitAuthMu.Unlock()
+
+	logInfo(fmt.Sprintf("Configured git to use SSH (key: %s, known hosts: %s, host key checking: %s)",
+		orDash(keyPath), config.GitKnownHosts, strictHostKeyChecking))
+	return nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// setupGitHTTPS makes git get the token from this binary acting as its askpass
+// helper. Credential helpers are disabled for our git invocations so the
+// token isn't stored anywhere (e.g. ~/.git-credentials) after a fetch.
+func setupGitHTTPS(ctx context.Context, config Config) {
+	// Never hang on an interactive prompt
+	setGitEnv("GIT_TERMINAL_PROMPT", "0")
+
+	if config.GitHTTPSToken == "" {
+		logWarning("GIT_HTTPS_TOKEN not provided, git HTTPS operations may fail")
+		return
+	}
+
+	remoteURL, err := gitRemoteURL(ctx, config.RepoPath)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not read the origin URL: %v", err))
+	}
+	remote, _ := url.Parse(remoteURL)
+	if remote != nil && remote.User != nil {
+		if _, hasPassword := remote.User.Password(); hasPassword {
+			logWarning("The origin URL embeds a password or token in .git/config; remove it with 'git remote set-url origin <url>'")
+		}
+	}
+	if remote != nil && remote.Scheme != "https" && remote.Scheme != "http" {
+		logWarning(fmt.Sprintf("GIT_AUTH_METHOD is https but origin is %s", remoteURL))
+	}
+
+	host := ""
+	if remote != nil {
+		host = remote.Hostname()
+	}
+	username := config.GitHTTPSUser
+	if username == "" {
+		username = gitHTTPSUsername(host)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not locate the arcane-gitops binary for GIT_ASKPASS: %v", err))
+		return
+	}
+
+	setGitEnv("GIT_ASKPASS", executable)
+	setGitEnv(askpassEnv, "1")
+	setGitEnv(askpassUserEnv, username)
+	setGitEnv(askpassPasswordEnv, config.GitHTTPSToken)
+	// An empty value resets the list of credential helpers
+	addGitConfigEnv("credential.helper", "")
+
+	logInfo(fmt.Sprintf("Configured git to use HTTPS with an access token (user %s)", username))
+}
+
+// gitHTTPSUsername is the username each forge expects alongside a token.
+// GitHub and GitLab need a specific one for some token types; Gitea and
+// Forgejo only look at the token.
+func gitHTTPSUsername(host string) string {
+	switch {
+	case host == "github.com" || strings.HasSuffix(host, ".ghe.com"):
+		return "x-access-token"
+	case strings.Contains(host, "gitlab"):
+		return "oauth2"
+	default:
+		return "git"
+	}
+}
+
+func gitRemoteURL(ctx context.Context, repoPath string) (string, error) {
+	output, err := gitCommand(ctx, "-C", repoPath, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// runAskpass answers git's username and password prompts. git passes the
+// prompt as the only argument, e.g. "Username for 'https://github.com': ".
+func runAskpass(args []string) int {
+	prompt := strings.ToLower(strings.Join(args, " "))
+	answer := os.Getenv(askpassPasswordEnv)
+	if strings.HasPrefix(prompt, "username") {
+		answer = os.Getenv(askpassUserEnv)
+	}
+	if answer == "" {
+		return 1
+	}
+	fmt.Println(answer)
+	return 0
+}
+
+// setGitEnv sets a variable for the git commands we run.
+func setGitEnv(key, value string) {
+	gitAuthMu.Lock()
+	defer gitAuthMu.Unlock()
+	gitAuthEnv[key] = value
+}
+
+// addGitConfigEnv passes a config setting to every git invocation through
+// GIT_CONFIG_COUNT/GIT_CONFIG_KEY_n/GIT_CONFIG_VALUE_n (git 2.31+), keeping
+// it out of both .git/config and the command line.
+func addGitConfigEnv(key, value string) {
+	gitAuthMu.Lock()
+	defer gitAuthMu.Unlock()
+	count, set := gitAuthEnv["GIT_CONFIG_COUNT"]
+	if !set {
+		// Settings passed to us the same way are kept
+		count = os.Getenv("GIT_CONFIG_COUNT")
+	}
+	n, _ := strconv.Atoi(count)
+	gitAuthEnv[fmt.Sprintf("GIT_CONFIG_KEY_%d", n)] = key
+	gitAuthEnv[fmt.Sprintf("GIT_CONFIG_VALUE_%d", n)] = value
+	gitAuthEnv["GIT_CONFIG_COUNT"] = strconv.Itoa(n + 1)
+}
+
+// resetGitAuthEnv forgets the previous setup, so a config reload can switch
+// methods cleanly.
+func resetGitAuthEnv() {
+	gitAuthMu.Lock()
+	defer gitAuthMu.Unlock()
+	clear(gitAuthEnv)
+	gitKnownHostsFile = ""
+}
+
+// gitEnviron is the environment of a git command: ours without credentials,
+// plus the variables setupGitAuth chose, which win.
+func gitEnviron() []string {
+	gitAuthMu.Lock()
+	defer gitAuthMu.Unlock()
+	env := environWithout(func(key string) bool {
+		return slices.Contains(credentialEnv, key)
+	})
+	keys := make([]string, 0, len(gitAuthEnv))
+	for key := range gitAuthEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+gitAuthEnv[key])
+	}
+	return env
+}
+
+// childEnviron is the environment of the commands we run other than git:
+// ours without credentials, nor git config passed to us through GIT_CONFIG_*,
+// which may carry some (e.g. an http.extraHeader).
+func childEnviron() []string {
+	return environWithout(func(key string) bool {
+		return slices.Contains(credentialEnv, key) || key == "GIT_CONFIG_COUNT" ||
+			strings.HasPrefix(key, "GIT_CONFIG_KEY_") || strings.HasPrefix(key, "GIT_CONFIG_VALUE_")
+	})
+}
+
+// environWithout returns our environment without the variables drop selects.
+func environWithout(drop func(key string) bool) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); !drop(key) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
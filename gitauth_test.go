@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChildEnvironWithoutCredentials(t *testing.T) {
+	t.Setenv("GIT_HTTPS_TOKEN", "token")
+	t.Setenv("ARCANE_API_KEY", "key")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "http.extraHeader")
+	t.Setenv("GIT_CONFIG_VALUE_0", "Authorization: Bearer token")
+	t.Setenv("SOPS_AGE_KEY_FILE", "/keys/age.txt")
+	resetGitAuthEnv()
+	t.Cleanup(resetGitAuthEnv)
+	setGitEnv(askpassPasswordEnv, "token")
+
+	tests := []struct {
+		name    string
+		env     []string
+		present []string
+		absent  []string
+	}{
+		{
+			name:    "git",
+			env:     gitEnviron(),
+			present: []string{"SOPS_AGE_KEY_FILE", "GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", askpassPasswordEnv},
+			absent:  []string{"GIT_HTTPS_TOKEN", "ARCANE_API_KEY"},
+		},
+		{
+			name:    "other commands",
+			env:     childEnviron(),
+			present: []string{"SOPS_AGE_KEY_FILE"},
+			absent:  []string{"GIT_HTTPS_TOKEN", "ARCANE_API_KEY", "GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0", askpassPasswordEnv},
+		},
+	}
+	for _, tt := range tests {
+		keys := make(map[string]bool)
+		for _, kv := range tt.env {
+			key, _, _ := strings.Cut(kv, "=")
+			keys[key] = true
+		}
+		for _, key := range tt.present {
+			if !keys[key] {
+				t.Errorf("%s: %s is missing", tt.name, key)
+			}
+		}
+		for _, key := range tt.absent {
+			if keys[key] {
+				t.Errorf("%s: %s is passed on", tt.name, key)
+			}
+		}
+	}
+}
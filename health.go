@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// healthyPollsRequired is how many polls in a row must find a project healthy,
+// so a container that crashes right after starting isn't taken for healthy.
+const healthyPollsRequired = 2
+
+// verifyHealth waits after a deploy until Arcane reports the project running
+// with every container up (and healthy, where it has a healthcheck). A project
+// that isn't healthy within HEALTH_TIMEOUT counts as failed.
+func verifyHealth(ctx context.Context, config Config, client *arcane.Client, name, projectID string) error {
+	if config.HealthTimeout <= 0 {
+		return nil
+	}
+
+	logInfo(fmt.Sprintf("Waiting up to %s for project %s to become healthy", config.HealthTimeout, name))
+	ctx, cancel := context.WithTimeout(ctx, config.HealthTimeout)
+	defer cancel()
+
+	healthyPolls := 0
+	project, err := client.WaitForProject(ctx, config.ArcaneEnvID, projectID, statusPollInterval, func(p *arcane.Project) bool {
+		if healthProblem(p) != "" {
+			healthyPolls = 0
+			return false
+		}
+		healthyPolls++
+		return healthyPolls >= healthyPollsRequired
+	})
+	if err != nil {
+		if project == nil || !errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("health check: %w", err)
+		}
+		problem := healthProblem(project)
+		if problem == "" {
+			problem = "it only just came up"
+		}
+		return fmt.Errorf("not healthy after %s: %s", config.HealthTimeout, problem)
+	}
+
+	logSuccess(fmt.Sprintf("Project %s is healthy", name))
+	return nil
+}
+
+// healthProblem describes why a project isn't healthy, or returns "" if it is.
+func healthProblem(p *arcane.Project) string {
+	var problems []string
+	if !strings.EqualFold(p.Status, arcane.StatusRunning) {
+		problem := fmt.Sprintf("status %q", p.Status)
+		if p.StatusReason != "" {
+			problem += " (" + p.StatusReason + ")"
+		}
+		problems = append(problems, problem)
+	}
+	for _, svc := range p.Services {
+		switch {
+		case svc.Status != "" && !strings.EqualFold(svc.Status, "running"):
+			problems = append(problems, fmt.Sprintf("%s is %s", svc.Name, strings.ToLower(svc.Status)))
+		case strings.EqualFold(svc.Health, "unhealthy"), strings.EqualFold(svc.Health, "starting"):
+			problems = append(problems, fmt.Sprintf("%s is %s", svc.Name, strings.ToLower(svc.Health)))
+		}
+	}
+	return strings.Join(problems, "; ")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile lists folders, in .gitignore syntax, that are never treated as
+// projects. It lives at the repository root.
+const ignoreFile = ".arcane-gitopsignore"
+
+// defaultIgnorePatterns come before the ignore file's own patterns, which can
+// re-include them with "!".
+var defaultIgnorePatterns = []string{".*", "syncTool"}
+
+// ignoreRules decides which folders discovery skips. As with .gitignore, the
+// last matching pattern wins, and nothing inside an ignored folder can be
+// re-included.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	segments []string // Slash-separated parts of the pattern
+	anchored bool     // Matched against the whole path rather than the folder name
+	negate   bool     // "!pattern" re-includes what an earlier pattern ignored
+}
+
+// loadIgnoreRules reads the repository's ignore file, if it has one.
+func loadIgnoreRules(config Config) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	for _, line := range defaultIgnorePatterns {
+		if err := rules.add(line); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.RepoPath, ignoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ignoreFile, err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if err := rules.add(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", ignoreFile, i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// add parses one line of an ignore file. Blank lines and comments are skipped.
+func (r *ignoreRules) add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	// Only folders are matched, so a trailing slash changes nothing
+	line = strings.TrimSuffix(line, "/")
+	if line == "" {
+		return nil
+	}
+	// A slash anywhere but at the end anchors the pattern to the repository root
+	p.anchored = strings.Contains(line, "/")
+	p.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", line)
+		}
+	}
+	r.patterns = append(r.patterns, p)
+	return nil
+}
+
+// excludes reports whether a folder, by its slash-separated path from the
+// repository root, is ignored itself or lies inside an ignored folder.
+func (r *ignoreRules) excludes(relPath string) bool {
+	segments := strings.Split(relPath, "/")
+	for i := 1; i <= len(segments); i++ {
+		if r.ignores(segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignores applies the patterns to a single folder.
+func (r *ignoreRules) ignores(segments []string) bool {
+	ignored := false
+	for _, p := range r.patterns {
+		var matched bool
+		if p.anchored {
+			matched = matchIgnoreSegments(p.segments, segments)
+		} else {
+			matched, _ = path.Match(p.segments[0], segments[len(segments)-1])
+		}
+		if matched {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchIgnoreSegments matches a path against an anchored pattern, where "**"
+// stands for any number of folders.
+func matchIgnoreSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			// A trailing "/**" matches everything inside, not the folder itself
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchIgnoreSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchIgnoreSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIgnoreRulesExcludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string // After the default patterns
+		path     string
+		want     bool
+	}{
+		{"defaults ignore hidden folders", nil, ".github", true},
+		{"defaults ignore syncTool", nil, "syncTool", true},
+		{"not ignored", nil, "apps/web", false},
+		{"negation re-includes a default", []string{"!.private"}, ".private", false},
+
+		{"name matches at any depth", []string{"wip"}, "apps/wip", true},
+		{"name matches the folder itself", []string{"wip"}, "wip", true},
+		{"glob", []string{"*-old"}, "apps/web-old", true},
+		{"glob needs a match", []string{"*-old"}, "apps/web", false},
+		{"trailing slash", []string{"wip/"}, "apps/wip", true},
+		{"inside an ignored folder", []string{"archive"}, "archive/web", true},
+
+		{"slash anchors", []string{"apps/wip"}, "apps/wip", true},
+		{"anchored misses other depths", []string{"apps/wip"}, "more/apps/wip", false},
+		{"leading slash anchors", []string{"/wip"}, "apps/wip", false},
+		{"leading slash matches the root", []string{"/wip"}, "wip", true},
+		{"double star", []string{"apps/**/test"}, "apps/a/b/test", true},
+		{"double star matches no folders", []string{"apps/**/test"}, "apps/test", true},
+		{"trailing double star", []string{"apps/**"}, "apps/web", true},
+		{"trailing double star spares the folder", []string{"apps/**"}, "apps", false},
+
+		{"negation", []string{"apps/*", "!apps/web"}, "apps/web", false},
+		{"negation leaves the rest ignored", []string{"apps/*", "!apps/web"}, "apps/db", true},
+		{"last match wins", []string{"!apps/web", "apps/*"}, "apps/web", true},
+		{"negation can't reach inside an ignored folder", []string{"apps", "!apps/web"}, "apps/web", true},
+		{"escaped bang", []string{`\!important`}, "!important", true},
+		{"comment", []string{"# apps"}, "apps", false},
+		{"escaped hash", []string{`\#tmp`}, "#tmp", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &ignoreRules{}
+			for _, line := range append(slices.Clone(defaultIgnorePatterns), tt.patterns...) {
+				if err := rules.add(line); err != nil {
+					t.Fatalf("add(%q): %v", line, err)
+				}
+			}
+			if got := rules.excludes(tt.path); got != tt.want {
+				t.Errorf("excludes(%q) with %q = %v, want %v", tt.path, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreRulesAddInvalid(t *testing.T) {
+	rules := &ignoreRules{}
+	if err := rules.add("apps/[web"); err == nil {
+		t.Error("add accepted an unterminated character class")
+	}
+}
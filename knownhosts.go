@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SSH host key policies
+const (
+	hostKeyPolicyTOFU   = "tofu"   // Trust a host on first contact, then insist on the same key
+	hostKeyPolicyStrict = "strict" // Only hosts already in the known_hosts file (or pinned)
+)
+
+// prepareKnownHosts makes sure the known_hosts file can be used and returns
+// the StrictHostKeyChecking value for ssh. Pinned fingerprints always mean
+// strict checking: the pins are the trust anchor, not first contact.
+func prepareKnownHosts(ctx context.Context, config Config) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(config.GitKnownHosts), 0750); err != nil {
+		return "", fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+
+	if len(config.GitHostKeyPins) > 0 {
+		if err := pinHostKeys(ctx, config.GitKnownHosts, config.GitHostKeyPins); err != nil {
+			return "", err
+		}
+		return "yes", nil
+	}
+
+	if config.GitHostKeyMode == hostKeyPolicyStrict {
+		if _, err := os.Stat(config.GitKnownHosts); err != nil {
+			return "", fmt.Errorf("GIT_SSH_HOST_KEY_POLICY=strict needs a known_hosts file at %s or GIT_SSH_HOST_FINGERPRINTS: %w", config.GitKnownHosts, err)
+		}
+		return "yes", nil
+	}
+	return "accept-new", nil
+}
+
+// pinHostKeys makes the known_hosts file hold exactly the pinned keys for every
+// pinned host. The server is only contacted (ssh-keyscan) when the file
+// doesn't already match; a scanned key is only written if its fingerprint is
+// pinned.
+func pinHostKeys(ctx context.Context, path string, pins []string) error {
+	var hosts []string
+	fingerprints := make(map[string][]string)
+	for _, pin := range pins {
+		host, fingerprint, err := parseHostKeyPin(pin)
+		if err != nil {
+			return err
+		}
+		if _, seen := fingerprints[host]; !seen {
+			hosts = append(hosts, host)
+		}
+		fingerprints[host] = append(fingerprints[host], fingerprint)
+	}
+
+	var lines []string
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	changed := false
+	for _, host := range hosts {
+		if knownKeysMatch(lines, host, fingerprints[host]) {
+			continue
+		}
+
+		scanned, err := scanHostKeys(ctx, host)
+		if err != nil {
+			return err
+		}
+		var matched, offered []string
+		for _, key := range scanned {
+			fingerprint, err := hostKeyFingerprint(key[1])
+			if err != nil {
+				continue
+			}
+			offered = append(offered, fingerprint)
+			if fingerprintIn(fingerprint, fingerprints[host]) {
+				matched = append(matched, host+" "+key[0]+" "+key[1])
+			}
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("SSH host key of %s does not match GIT_SSH_HOST_FINGERPRINTS (server offered %s); the key was changed or the connection is being intercepted",
+				host, strings.Join(offered, ", "))
+		}
+
+		kept := lines[:0:0]
+		for _, line := range lines {
+			if _, _, ok := knownHostsEntry(line, host); !ok {
+				kept = append(kept, line)
+			}
+		}
+		lines = append(kept, matched...)
+		changed = true
+		logInfo(fmt.Sprintf("Pinned SSH host key for %s in %s", host, path))
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return nil
+}
+
+// parseHostKeyPin splits "host=SHA256:..." (or "host:port=SHA256:...") and
+// returns the host the way known_hosts spells it.
+func parseHostKeyPin(pin string) (string, string, error) {
+	host, fingerprint, found := strings.Cut(strings.TrimSpace(pin), "=")
+	host, fingerprint = strings.TrimSpace(host), strings.TrimSpace(fingerprint)
+	if !found || host == "" || !strings.HasPrefix(fingerprint, "SHA256:") {
+		return "", "", fmt.Errorf("%q is not host=SHA256:fingerprint (as printed by ssh-keygen -lf)", pin)
+	}
+	if name, port, hasPort := strings.Cut(host, ":"); hasPort && !strings.HasPrefix(host, "[") && port != "22" {
+		host = "[" + name + "]:" + port
+	} else if hasPort && port == "22" {
+		host = name
+	}
+	return host, strings.TrimRight(fingerprint, "="), nil
+}
+
+// knownKeysMatch reports whether the file has keys for host and all of them
+// are pinned.
+func knownKeysMatch(lines []string, host string, fingerprints []string) bool {
+	found := false
+	for _, line := range lines {
+		_, key, ok := knownHostsEntry(line, host)
+		if !ok {
+			continue
+		}
+		fingerprint, err := hostKeyFingerprint(key)
+		if err != nil || !fingerprintIn(fingerprint, fingerprints) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// knownHostsEntry returns the key type and key of a known_hosts line for host.
+// Marker lines (@cert-authority, @revoked) are left alone.
+func knownHostsEntry(line, host string) (string, string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return "", "", false
+	}
+	if !knownHostsPatternMatches(fields[0], host) {
+		return "", "", false
+	}
+	return fields[1], fields[2], true
+}
+
+func knownHostsPatternMatches(patterns, host string) bool {
+	// Hashed entry: |1|base64(salt)|base64(HMAC-SHA1(salt, host))
+	if strings.HasPrefix(patterns, "|1|") {
+		parts := strings.Split(patterns, "|")
+		if len(parts) != 4 {
+			return false
+		}
+		salt, err1 := base64.StdEncoding.DecodeString(parts[2])
+		sum, err2 := base64.StdEncoding.DecodeString(parts[3])
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(host))
+		return hmac.Equal(mac.Sum(nil), sum)
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+// scanHostKeys asks the server for its host keys. Each result is {type, key}.
+func scanHostKeys(ctx context.Context, host string) ([][2]string, error) {
+	args := []string{"-T", "10"}
+	name := host
+	if strings.HasPrefix(host, "[") {
+		var port string
+		name, port, _ = strings.Cut(strings.TrimPrefix(host, "["), "]:")
+		args = append(args, "-p", port)
+	}
+	args = append(args, name)
+
+	cmd := exec.CommandContext(ctx, "ssh-keyscan", args...)
+	cmd.Env = childEnviron()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh-keyscan %s failed: %w", host, err)
+	}
+
+	var keys [][2]string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && !strings.HasPrefix(fields[0], "#") {
+			keys = append(keys, [2]string{fields[1], fields[2]})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ssh-keyscan %s returned no host keys", host)
+	}
+	return keys, nil
+}
+
+// hostKeyFingerprint computes the fingerprint ssh-keygen -lf prints.
+func hostKeyFingerprint(key string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", errors.New("invalid host key encoding")
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+func fingerprintIn(fingerprint string, fingerprints []string) bool {
+	for _, candidate := range fingerprints {
+		if candidate == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// sshHostKeyHint turns ssh's host key failures into an actionable message.
+func sshHostKeyHint(stderr string) string {
+	gitAuthMu.Lock()
+	knownHosts := gitKnownHostsFile
+	gitAuthMu.Unlock()
+	if knownHosts == "" {
+		knownHosts = "known_hosts"
+	}
+
+	switch {
+	case strings.Contains(stderr, "REMOTE HOST IDENTIFICATION HAS CHANGED"):
+		host := "the remote"
+		if _, rest, found := strings.Cut(stderr, "Host key for "); found {
+			host, _, _ = strings.Cut(rest, " ")
+		}
+		return fmt.Sprintf("the SSH host key of %s has changed since it was trusted (known_hosts: %s). "+
+			"If the change is expected, remove the old key with 'ssh-keygen -R %s -f %s' or update GIT_SSH_HOST_FINGERPRINTS; "+
+			"otherwise the connection may be intercepted", host, knownHosts, host, knownHosts)
+	case strings.Contains(stderr, "Host key verification failed"):
+		return fmt.Sprintf("the SSH host key of the remote is not trusted (known_hosts: %s). "+
+			"Add it to that file, set GIT_SSH_HOST_FINGERPRINTS, or use GIT_SSH_HOST_KEY_POLICY=tofu", knownHosts)
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHostKeyPin(t *testing.T) {
+	tests := []struct {
+		pin         string
+		host        string
+		fingerprint string
+		wantErr     bool
+	}{
+		{pin: "github.com=SHA256:abc", host: "github.com", fingerprint: "SHA256:abc"},
+		{pin: " github.com = SHA256:abc= ", host: "github.com", fingerprint: "SHA256:abc"},
+		{pin: "git.example.com:2222=SHA256:abc", host: "[git.example.com]:2222", fingerprint: "SHA256:abc"},
+		{pin: "git.example.com:22=SHA256:abc", host: "git.example.com", fingerprint: "SHA256:abc"},
+		{pin: "[git.example.com]:2222=SHA256:abc", host: "[git.example.com]:2222", fingerprint: "SHA256:abc"},
+		{pin: "github.com", wantErr: true},
+		{pin: "=SHA256:abc", wantErr: true},
+		{pin: "github.com=MD5:ab:cd", wantErr: true},
+		{pin: "github.com=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		host, fingerprint, err := parseHostKeyPin(tt.pin)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHostKeyPin(%q) = %q, %q, want an error", tt.pin, host, fingerprint)
+			}
+			continue
+		}
+		if err != nil || host != tt.host || fingerprint != tt.fingerprint {
+			t.Errorf("parseHostKeyPin(%q) = %q, %q, %v, want %q, %q", tt.pin, host, fingerprint, err, tt.host, tt.fingerprint)
+		}
+	}
+}
+
+func TestKnownKeysMatch(t *testing.T) {
+	key := func(blob string) (string, string) {
+		sum := sha256.Sum256([]byte(blob))
+		return base64.StdEncoding.EncodeToString([]byte(blob)), "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+	}
+	ed25519, ed25519Print := key("ed25519 host key")
+	rsa, rsaPrint := key("rsa host key")
+	other, _ := key("someone else's key")
+
+	salt := []byte("0123456789abcdef0123")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("github.com"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name         string
+		lines        []string
+		host         string
+		fingerprints []string
+		want         bool
+	}{
+		{"pinned key", []string{"github.com ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, true},
+		{"every key pinned", []string{"github.com ssh-ed25519 " + ed25519, "github.com ssh-rsa " + rsa}, "github.com", []string{rsaPrint, ed25519Print}, true},
+		{"a key isn't pinned", []string{"github.com ssh-ed25519 " + ed25519, "github.com ssh-rsa " + rsa}, "github.com", []string{ed25519Print}, false},
+		{"wrong key", []string{"github.com ssh-ed25519 " + other}, "github.com", []string{ed25519Print}, false},
+		{"no key for the host", []string{"gitlab.com ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, false},
+		{"empty file", nil, "github.com", []string{ed25519Print}, false},
+		{"other hosts are ignored", []string{"gitlab.com ssh-ed25519 " + other, "github.com ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, true},
+		{"host in a pattern list", []string{"gitlab.com,github.com,140.82.121.4 ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, true},
+		{"hashed host", []string{hashed + " ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, true},
+		{"hashed other host", []string{hashed + " ssh-ed25519 " + ed25519}, "gitlab.com", []string{ed25519Print}, false},
+		{"port", []string{"[git.example.com]:2222 ssh-ed25519 " + ed25519}, "[git.example.com]:2222", []string{ed25519Print}, true},
+		{"port must match", []string{"[git.example.com]:2222 ssh-ed25519 " + ed25519}, "git.example.com", []string{ed25519Print}, false},
+		{"markers and comments are skipped", []string{"# github.com ssh-ed25519 " + other, "@revoked github.com ssh-ed25519 " + other, "github.com ssh-ed25519 " + ed25519}, "github.com", []string{ed25519Print}, true},
+		{"invalid key", []string{"github.com ssh-ed25519 !!!"}, "github.com", []string{ed25519Print}, false},
+	}
+	for _, tt := range tests {
+		if got := knownKeysMatch(tt.lines, tt.host, tt.fingerprints); got != tt.want {
+			t.Errorf("%s: knownKeysMatch = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSSHHostKeyHintDuringReload(t *testing.T) {
+	saved := consoleOutput
+	consoleOutput = &strings.Builder{}
+	t.Cleanup(func() { consoleOutput = saved })
+	t.Cleanup(resetGitAuthEnv)
+	config := Config{GitAuthMethod: "ssh", GitKnownHosts: filepath.Join(t.TempDir(), "known_hosts"), GitHostKeyMode: hostKeyPolicyTOFU}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// What a SIGHUP reload does while a sync reports a git failure
+		for i := 0; i < 20; i++ {
+			if err := setupGitAuth(context.Background(), config); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if hint := sshHostKeyHint("Host key verification failed."); !strings.Contains(hint, "known_hosts") {
+			t.Fatalf("sshHostKeyHint = %q", hint)
+		}
+	}
+	<-done
+}
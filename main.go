@@ -2,19 +2,29 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
 )
 
+const defaultConfigFile = "/etc/arcane-gitops/config.env"
+
+// consoleOutput receives the human-readable log lines. Commands that print
+// machine-readable output on stdout redirect it to stderr.
+var consoleOutput io.Writer = os.Stdout
+
 const (
 	colorReset  = "\033[0m"
 	colorRed    = "\033[31m"
@@ -24,628 +34,259 @@ const (
 )
 
 type Config struct {
-	RepoPath      string
-	ArcaneBaseURL string // Arcane API base URL (e.g., http://localhost:3552)
-	ArcaneAPIKey  string // Arcane API key
-	ArcaneEnvID   string
-	LogFile       string
-	GitAuthMethod string // Authentication method: "ssh" or "https"
-	GitSSHKeyPath string // SSH private key for git operations (if using SSH)
-	GitHTTPSToken string // GitHub personal access token (if using HTTPS)
-}
-
-// Arcane API types
-type ArcaneProject struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Status         string `json:"status"`
-	StatusReason   string `json:"statusReason"`
-	DirName        string `json:"dirName"`
-	Path           string `json:"path"`
-	ComposeContent string `json:"composeContent"`
-	EnvContent     string `json:"envContent"`
-	CreatedAt      string `json:"createdAt"`
-	UpdatedAt      string `json:"updatedAt"`
-}
-
-type ArcanePagination struct {
-	CurrentPage     int `json:"currentPage"`
-	GrandTotalItems int `json:"grandTotalItems"`
-	ItemsPerPage    int `json:"itemsPerPage"`
-	TotalItems      int `json:"totalItems"`
-	TotalPages      int `json:"totalPages"`
-}
-
-// Paginated response wrapper
-type ArcanePaginatedResponse struct {
-	Success    bool             `json:"success"`
-	Data       []ArcaneProject  `json:"data"`
-	Pagination ArcanePagination `json:"pagination"`
-}
-
-type ArcaneCreateResponse struct {
-	Success bool `json:"success"`
-	Data    struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	} `json:"data"`
-}
-
-type ArcaneAPIClient struct {
-	BaseURL    string
-	APIKey     string
-	EnvID      string
-	HTTPClient *http.Client
-}
-
-func NewArcaneAPIClient(baseURL, apiKey, envID string) *ArcaneAPIClient {
-	return &ArcaneAPIClient{
-		BaseURL: strings.TrimRight(baseURL, "/"),
-		APIKey:  apiKey,
-		EnvID:   envID,
-		HTTPClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
-	}
-}
-
-func (c *ArcaneAPIClient) doRequest(method, endpoint string, body interface{}) ([]byte, error) {
-	url := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
-
-	var reqBody io.Reader
-	if body != nil {
-		jsonData, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
-		}
-		reqBody = bytes.NewBuffer(jsonData)
-	}
-
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("X-Api-Key", c.APIKey)
-	// Arcane API docs sometimes show API keys used as Bearer tokens.
-	// Setting both headers makes this client compatible across versions.
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer func() {
-		_ = resp.Body.Close() // Ignore close errors
-	}()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
-	return respBody, nil
+	RepoPath          string
+	ProjectsDir       string // Subdirectory of the repository holding the projects ("" for the root)
+	ProjectsDepth     int    // How many folder levels below ProjectsDir are searched for projects
+	ArcaneBaseURL     string // Arcane API base URL (e.g., http://localhost:3552)
+	ArcaneAPIKey      string // Arcane API key
+	ArcaneEnvID       string
+	ArcaneEnvMap      []string // Project path patterns mapped to environment IDs, "pattern=id"
+	LogFile           string
+	ArcaneRetry       arcane.RetryPolicy // Retries for transient Arcane API failures
+	GitAuthMethod     string             // Authentication method: "ssh", "https" or "none"
+	GitSSHKeyPath     string             // SSH private key for git operations (if using SSH)
+	GitKnownHosts     string             // known_hosts file trusted (and, with TOFU, extended) for SSH remotes
+	GitHostKeyMode    string             // SSH host key policy: "tofu" or "strict"
+	GitHostKeyPins    []string           // Pinned host key fingerprints, "host=SHA256:..."
+	GitHTTPSToken     string             // Access token for GitHub, GitLab or Gitea (if using HTTPS)
+	GitHTTPSUser      string             // Username sent with the token; derived from the git host if empty
+	AgeKeyFile        string             // age identity for encrypted env files, also passed to sops
+	SkipDecrypt       bool               // Check encrypted env files without decrypting them (validate --no-decrypt)
+	StateFile         string             // Durable record of the last successfully applied content per project
+	PruneEnabled      bool               // Remove Arcane projects whose folders were deleted from the repo
+	PruneMaxPerRun    int                // Refuse to prune when more projects than this would be removed at once
+	DriftPolicy       string             // What to do when Arcane content differs from disk: "off", "report" or "reapply"
+	ComposeValidation bool               // Refuse to sync projects whose compose files fail validation
+	PolicyFile        string             // Rules compose projects must follow; relative to the repository unless absolute
+	SyncFilter        PathFilter         // Which non-compose files in a project folder trigger a sync
+	SyncTimeout       time.Duration      // Deadline for a whole sync pass, git fetch included
+	ProjectTimeout    time.Duration      // Deadline for applying a single project
+	HealthTimeout     time.Duration      // How long a deployed project may take to become healthy; 0 skips the check
+	RollbackEnabled   bool               // Re-apply the last good commit when an update fails to deploy
+	SyncInterval      time.Duration      // Daemon mode: time between sync passes
+	SyncJitter        time.Duration      // Daemon mode: random delay added to each interval
+	WebhookListen     string             // Daemon mode: address for the push webhook listener (empty disables it)
+	WebhookSecret     string             // Shared secret used to verify webhook signatures / tokens
+	WebhookDebounce   time.Duration      // Quiet period after the last push before syncing
+}
+
+// arcaneHTTPClient is shared by every Arcane client the process creates, so
+// a config reload keeps the pooled connections.
+var arcaneHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// newArcaneClient builds the Arcane API client for a configuration.
+func newArcaneClient(config Config) *arcane.Client {
+	return arcane.New(config.ArcaneBaseURL,
+		arcane.WithAPIKey(config.ArcaneAPIKey),
+		arcane.WithHTTPClient(arcaneHTTPClient),
+		arcane.WithUserAgent("arcane-gitops/"+version),
+		arcane.WithRetryPolicy(config.ArcaneRetry),
+		arcane.WithRetryHook(func(err error, attempt int, delay time.Duration) {
+			logWarning(fmt.Sprintf("%v; retrying in %s (attempt %d/%d)",
+				err, delay.Round(time.Millisecond), attempt, config.ArcaneRetry.MaxAttempts))
+		}))
 }
 
-func (c *ArcaneAPIClient) ListProjects() ([]ArcaneProject, error) {
-	return c.listProjectsAll("")
-}
-
-func (c *ArcaneAPIClient) ProjectExists(projectName string) (bool, string, error) {
-	projects, err := c.ListProjects()
-	if err != nil {
-		return false, "", err
-	}
-
-	for _, p := range projects {
-		if p.Name == projectName {
-			return true, p.ID, nil
-		}
-	}
-	return false, "", nil
-}
-
-func (c *ArcaneAPIClient) FindProjectsByNameExact(projectName string) ([]ArcaneProject, error) {
-	projects, err := c.listProjectsAll(projectName)
-	if err != nil {
-		return nil, err
-	}
-
-	var exact []ArcaneProject
-	for _, p := range projects {
-		if p.Name == projectName {
-			exact = append(exact, p)
-		}
-	}
-	return exact, nil
+type GitStatus struct {
+	Ahead          int
+	Behind         int
+	HasLocalChange bool
 }
 
-func (c *ArcaneAPIClient) listProjectsAll(search string) ([]ArcaneProject, error) {
-	const pageSize = 50
-	start := 0
-	var all []ArcaneProject
-
-	for {
-		endpointURL := &url.URL{
-			Path: fmt.Sprintf("/api/environments/%s/projects", c.EnvID),
-		}
-		q := endpointURL.Query()
-		q.Set("start", fmt.Sprintf("%d", start))
-		q.Set("limit", fmt.Sprintf("%d", pageSize))
-		if search != "" {
-			q.Set("search", search)
-		}
-		endpointURL.RawQuery = q.Encode()
-
-		respBody, err := c.doRequest("GET", endpointURL.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-
-		var paginatedResp ArcanePaginatedResponse
-		if err := json.Unmarshal(respBody, &paginatedResp); err != nil {
-			return nil, fmt.Errorf("failed to parse projects response: %w\nBody: %s", err, string(respBody))
-		}
-
-		all = append(all, paginatedResp.Data...)
-
-		// Stop conditions:
-		// - last page (returned fewer than requested)
-		// - pagination reports total and we've collected enough
-		if len(paginatedResp.Data) < pageSize {
-			break
-		}
-
-		total := 0
-		if paginatedResp.Pagination.GrandTotalItems > 0 {
-			total = paginatedResp.Pagination.GrandTotalItems
-		} else if paginatedResp.Pagination.TotalItems > 0 {
-			total = paginatedResp.Pagination.TotalItems
-		}
-		if total > 0 && len(all) >= total {
-			break
-		}
-
-		start += pageSize
+func main() {
+	// git runs this binary as its askpass helper during HTTPS fetches
+	if os.Getenv(askpassEnv) != "" {
+		os.Exit(runAskpass(os.Args[1:]))
 	}
-
-	return all, nil
+	os.Exit(runCLI(os.Args[1:]))
 }
 
-func (c *ArcaneAPIClient) CreateProject(name, composeContent, envContent string) (string, error) {
-	endpoint := fmt.Sprintf("/api/environments/%s/projects", c.EnvID)
-
-	reqBody := map[string]interface{}{
-		"name":           name,
-		"composeContent": composeContent,
-	}
-	if envContent != "" {
-		reqBody["envContent"] = envContent
-	}
-
-	respBody, err := c.doRequest("POST", endpoint, reqBody)
+func loadConfig() (Config, error) {
+	config, err := buildConfig()
 	if err != nil {
-		return "", err
+		return Config{}, err
 	}
-
-	var createResp ArcaneCreateResponse
-	if err := json.Unmarshal(respBody, &createResp); err != nil {
-		return "", fmt.Errorf("failed to parse create response: %w", err)
-	}
-
-	if createResp.Data.ID != "" {
-		return createResp.Data.ID, nil
-	}
-	return name, nil // Fallback to name as ID
+	return config, validateConfig(config)
 }
 
-func (c *ArcaneAPIClient) UpdateProject(projectID, composeContent, envContent string) error {
-	endpoint := fmt.Sprintf("/api/environments/%s/projects/%s", c.EnvID, projectID)
-
-	reqBody := map[string]interface{}{}
-	if composeContent != "" {
-		reqBody["composeContent"] = composeContent
-	}
-	if envContent != "" {
-		reqBody["envContent"] = envContent
+// buildConfig reads the configuration without validating it, for commands
+// that only need part of it.
+func buildConfig() (Config, error) {
+	if err := applyConfigFile(false); err != nil {
+		return Config{}, err
 	}
 
-	_, err := c.doRequest("PUT", endpoint, reqBody)
-	return err
-}
-
-func (c *ArcaneAPIClient) StartProject(projectID string) error {
-	endpoint := fmt.Sprintf("/api/environments/%s/projects/%s/up", c.EnvID, projectID)
-	_, err := c.doRequest("POST", endpoint, nil)
-	return err
-}
-
-func (c *ArcaneAPIClient) DeployProject(projectID string) error {
-	endpoint := fmt.Sprintf("/api/environments/%s/projects/%s/deploy", c.EnvID, projectID)
-	reqBody := map[string]bool{"pull": true}
-	_, err := c.doRequest("POST", endpoint, reqBody)
-	return err
-}
-
-func (c *ArcaneAPIClient) RedeployProject(projectID string) error {
-	// Try deploy first, then redeploy
-	endpoint := fmt.Sprintf("/api/environments/%s/projects/%s/redeploy", c.EnvID, projectID)
-	_, err := c.doRequest("POST", endpoint, nil)
-	return err
-}
-
-type GitStatus struct {
-	Ahead          int
-	Behind         int
-	HasLocalChange bool
-}
-
-func main() {
 	config := Config{
 		RepoPath:      os.Getenv("COMPOSE_REPO_PATH"),
+		ProjectsDir:   cleanProjectsDir(os.Getenv("PROJECTS_DIR")),
+		ProjectsDepth: getEnvInt("PROJECTS_DEPTH", 1),
 		ArcaneBaseURL: os.Getenv("ARCANE_BASE_URL"),
 		ArcaneAPIKey:  os.Getenv("ARCANE_API_KEY"),
 		ArcaneEnvID:   getEnvOrDefault("ARCANE_ENV_ID", "0"),
+		ArcaneEnvMap:  getEnvList("ARCANE_ENV_MAP"),
 		LogFile:       getEnvOrDefault("LOG_FILE", "/var/log/arcane-gitops.log"),
-		GitAuthMethod: getEnvOrDefault("GIT_AUTH_METHOD", "ssh"),
-		GitSSHKeyPath: os.Getenv("GIT_SSH_KEY_PATH"),
-		GitHTTPSToken: os.Getenv("GIT_HTTPS_TOKEN"),
+		ArcaneRetry: arcane.RetryPolicy{
+			MaxAttempts: getEnvInt("ARCANE_RETRY_ATTEMPTS", arcane.DefaultRetryPolicy.MaxAttempts),
+			BaseDelay:   getEnvDuration("ARCANE_RETRY_BASE_DELAY", arcane.DefaultRetryPolicy.BaseDelay),
+			MaxDelay:    getEnvDuration("ARCANE_RETRY_MAX_DELAY", arcane.DefaultRetryPolicy.MaxDelay),
+		},
+		GitAuthMethod:     getEnvOrDefault("GIT_AUTH_METHOD", "ssh"),
+		GitSSHKeyPath:     os.Getenv("GIT_SSH_KEY_PATH"),
+		GitHostKeyMode:    strings.ToLower(getEnvOrDefault("GIT_SSH_HOST_KEY_POLICY", hostKeyPolicyTOFU)),
+		GitHostKeyPins:    getEnvList("GIT_SSH_HOST_FINGERPRINTS"),
+		GitHTTPSToken:     os.Getenv("GIT_HTTPS_TOKEN"),
+		GitHTTPSUser:      os.Getenv("GIT_HTTPS_USERNAME"),
+		AgeKeyFile:        os.Getenv("SOPS_AGE_KEY_FILE"),
+		StateFile:         getEnvOrDefault("STATE_FILE", "/var/lib/arcane-gitops/state.json"),
+		PruneEnabled:      getEnvBool("PRUNE_ENABLED", false),
+		PruneMaxPerRun:    getEnvInt("PRUNE_MAX_PER_RUN", 3),
+		DriftPolicy:       strings.ToLower(getEnvOrDefault("DRIFT_POLICY", driftPolicyReport)),
+		ComposeValidation: getEnvBool("COMPOSE_VALIDATION", true),
+		PolicyFile:        os.Getenv("POLICY_FILE"),
+		SyncFilter: PathFilter{
+			Include: getEnvList("SYNC_INCLUDE"),
+			Exclude: getEnvList("SYNC_EXCLUDE"),
+		},
+		SyncTimeout:     getEnvDuration("SYNC_TIMEOUT", 30*time.Minute),
+		ProjectTimeout:  getEnvDuration("PROJECT_TIMEOUT", 5*time.Minute),
+		HealthTimeout:   getEnvDuration("HEALTH_TIMEOUT", 2*time.Minute),
+		RollbackEnabled: getEnvBool("ROLLBACK_ENABLED", false),
+		SyncInterval:    getEnvDuration("SYNC_INTERVAL", 5*time.Minute),
+		SyncJitter:      getEnvDuration("SYNC_JITTER", 30*time.Second),
+		WebhookListen:   os.Getenv("WEBHOOK_LISTEN"),
+		WebhookSecret:   os.Getenv("WEBHOOK_SECRET"),
+		WebhookDebounce: getEnvDuration("WEBHOOK_DEBOUNCE", 10*time.Second),
 	}
+	// Kept next to the sync state by default, where the service may write
+	config.GitKnownHosts = getEnvOrDefault("GIT_SSH_KNOWN_HOSTS", filepath.Join(filepath.Dir(config.StateFile), "known_hosts"))
+
+	return config, nil
+}
 
-	// Validate configuration
+func validateConfig(config Config) error {
 	if config.RepoPath == "" {
-		log.Fatal("COMPOSE_REPO_PATH environment variable is required")
+		return errors.New("COMPOSE_REPO_PATH environment variable is required")
+	}
+	if err := validateProjectsDir(config); err != nil {
+		return err
 	}
 	if config.ArcaneBaseURL == "" {
-		log.Fatal("ARCANE_BASE_URL environment variable is required (e.g., http://localhost:3552)")
+		return errors.New("ARCANE_BASE_URL environment variable is required (e.g., http://localhost:3552)")
 	}
 	if config.ArcaneAPIKey == "" {
-		log.Fatal("ARCANE_API_KEY environment variable is required")
-	}
-
-	// Setup git authentication based on configured method
-	setupGitAuth(config.GitAuthMethod, config.GitSSHKeyPath, config.GitHTTPSToken)
-
-	// Setup logging
-	setupLogging(config.LogFile)
-
-	logInfo("Starting compose sync check")
-	logInfo(fmt.Sprintf("Repository: %s", config.RepoPath))
-
-	// Change to repo directory
-	if err := os.Chdir(config.RepoPath); err != nil {
-		logError(fmt.Sprintf("Failed to change to repository directory: %v", err))
-		os.Exit(1)
+		return errors.New("ARCANE_API_KEY environment variable is required")
 	}
-
-	// Fetch latest from remote
-	logInfo("Fetching from remote...")
-	if err := runGitCommand("fetch", "origin"); err != nil {
-		logError(fmt.Sprintf("Failed to fetch from remote: %v", err))
-		os.Exit(1)
+	if err := validateEnvMap(config); err != nil {
+		return err
 	}
-
-	// Get current branch
-	branch, err := getCurrentBranch()
-	if err != nil {
-		logError(fmt.Sprintf("Failed to get current branch: %v", err))
-		os.Exit(1)
+	if config.ArcaneRetry.MaxAttempts < 1 {
+		return errors.New("ARCANE_RETRY_ATTEMPTS must be at least 1")
 	}
-	logInfo(fmt.Sprintf("Current branch: %s", branch))
-
-	// Check git status
-	status, err := getGitStatus(branch)
-	if err != nil {
-		logError(fmt.Sprintf("Failed to get git status: %v", err))
-		os.Exit(1)
+	if config.ArcaneRetry.BaseDelay < 0 || config.ArcaneRetry.MaxDelay < 0 {
+		return errors.New("ARCANE_RETRY_BASE_DELAY and ARCANE_RETRY_MAX_DELAY must not be negative")
 	}
-
-	// Get current commit before any changes
-	oldCommit, err := getCurrentCommit()
-	if err != nil {
-		logError(fmt.Sprintf("Failed to get current commit: %v", err))
-		os.Exit(1)
+	if config.GitHostKeyMode != hostKeyPolicyTOFU && config.GitHostKeyMode != hostKeyPolicyStrict {
+		return fmt.Errorf("GIT_SSH_HOST_KEY_POLICY must be %q or %q", hostKeyPolicyTOFU, hostKeyPolicyStrict)
 	}
-
-	changesOccurred := false
-
-	// Handle diverged state (both ahead and behind)
-	// GitOps principle: Remote is always the source of truth
-	if status.Ahead > 0 && status.Behind > 0 {
-		logWarning(fmt.Sprintf("Local has diverged (ahead by %d, behind by %d)", status.Ahead, status.Behind))
-		logWarning("Remote is source of truth - discarding local commits and syncing to remote")
-
-		// Discard local changes and commits, force sync to remote
-		if err := runGitCommand("fetch", "origin", branch); err != nil {
-			logError(fmt.Sprintf("Failed to fetch: %v", err))
-			os.Exit(1)
-		}
-		if err := runGitCommand("reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
-			logError(fmt.Sprintf("Failed to reset to remote: %v", err))
-			os.Exit(1)
-		}
-		// Clean untracked files but preserve local env files
-		if err := runGitCommand("clean", "-fd", "-e", ".env.global", "-e", "*.env.local", "-e", ".env"); err != nil {
-			logWarning(fmt.Sprintf("Failed to clean untracked files: %v", err))
-		}
-		logSuccess("Successfully force-synced to remote")
-		changesOccurred = true
-	} else if status.Ahead > 0 {
-		// Only ahead (not behind) - this is unusual for GitOps but handle it
-		logWarning(fmt.Sprintf("Local is ahead by %d commits (unusual for GitOps)", status.Ahead))
-		logWarning("Remote is source of truth - discarding local commits")
-
-		if err := runGitCommand("fetch", "origin", branch); err != nil {
-			logError(fmt.Sprintf("Failed to fetch: %v", err))
-			os.Exit(1)
-		}
-		if err := runGitCommand("reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
-			logError(fmt.Sprintf("Failed to reset to remote: %v", err))
-			os.Exit(1)
+	for _, pin := range config.GitHostKeyPins {
+		if _, _, err := parseHostKeyPin(pin); err != nil {
+			return fmt.Errorf("GIT_SSH_HOST_FINGERPRINTS: %w", err)
 		}
-		logSuccess("Successfully reset to remote")
-		// No changesOccurred since we're just discarding local, remote hasn't changed
-	}
-
-	// Handle behind (need to pull) - only if not already handled in diverged case
-	if status.Behind > 0 && status.Ahead == 0 {
-		logInfo(fmt.Sprintf("Local is behind by %d commits, pulling...", status.Behind))
-
-		// GitOps principle: Remote is the source of truth
-		// Discard any local changes and force sync to remote
-		if status.HasLocalChange {
-			logWarning("Local changes detected, discarding (remote is source of truth)...")
-			// Reset any staged changes
-			if err := runGitCommand("reset", "--hard", "HEAD"); err != nil {
-				logWarning(fmt.Sprintf("Failed to reset HEAD: %v", err))
-			}
-			// Clean untracked files but preserve local env files
-			if err := runGitCommand("clean", "-fd", "-e", ".env.global", "-e", "*.env.local", "-e", ".env"); err != nil {
-				logWarning(fmt.Sprintf("Failed to clean untracked files: %v", err))
-			}
-		}
-
-		// Force local branch to match remote exactly
-		if err := runGitCommand("fetch", "origin", branch); err != nil {
-			logError(fmt.Sprintf("Failed to fetch: %v", err))
-			os.Exit(1)
-		}
-
-		// Reset local branch to match remote
-		if err := runGitCommand("reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
-			logError(fmt.Sprintf("Failed to reset to remote: %v", err))
-			os.Exit(1)
-		}
-		logSuccess("Successfully synced to remote (force reset)")
-		changesOccurred = true
 	}
-
-	// If both ahead and behind, we already handled it above
-	// The pull with rebase should handle this scenario
-
-	// Create Arcane API client
-	arcane := NewArcaneAPIClient(config.ArcaneBaseURL, config.ArcaneAPIKey, config.ArcaneEnvID)
-
-	// Get list of projects on disk
-	diskProjects, err := listDiskProjects(config)
-	if err != nil {
-		logError(fmt.Sprintf("Failed to list disk projects: %v", err))
-		os.Exit(1)
+	if !isValidDriftPolicy(config.DriftPolicy) {
+		return fmt.Errorf("DRIFT_POLICY must be one of %q, %q or %q", driftPolicyOff, driftPolicyReport, driftPolicyReapply)
 	}
-	logInfo(fmt.Sprintf("Found %d project(s) on disk", len(diskProjects)))
-
-	// Get list of projects in Arcane
-	arcaneProjects, err := arcane.ListProjects()
-	if err != nil {
-		logWarning(fmt.Sprintf("Could not list Arcane projects: %v", err))
-		arcaneProjects = []ArcaneProject{} // Continue with empty list
+	if config.SyncTimeout <= 0 {
+		return errors.New("SYNC_TIMEOUT must be positive")
 	}
-	logInfo(fmt.Sprintf("Found %d project(s) in Arcane", len(arcaneProjects)))
-
-	// Index Arcane projects by name (Arcane can contain duplicates)
-	arcaneProjectsByName := make(map[string][]ArcaneProject)
-	for _, p := range arcaneProjects {
-		arcaneProjectsByName[p.Name] = append(arcaneProjectsByName[p.Name], p)
+	if config.ProjectTimeout <= 0 {
+		return errors.New("PROJECT_TIMEOUT must be positive")
 	}
-
-	// Warn about duplicates to prevent surprising behavior
-	for name, projects := range arcaneProjectsByName {
-		if len(projects) > 1 {
-			var ids []string
-			for _, p := range projects {
-				ids = append(ids, p.ID)
-			}
-			logWarning(fmt.Sprintf("Multiple Arcane projects share the same name '%s' (IDs: %s). arcane-gitops will only operate on one; please delete duplicates in Arcane UI.", name, strings.Join(ids, ", ")))
-		}
+	if config.HealthTimeout < 0 || config.HealthTimeout >= config.ProjectTimeout {
+		return errors.New("HEALTH_TIMEOUT must be between 0 (disabled) and PROJECT_TIMEOUT")
 	}
-
-	// Determine which projects need action
-	var projectsToCreate []string
-	var projectsToSync []string
-
-	// Check if git changed
-	var changedProjects map[string]string
-	if changesOccurred {
-		newCommit, err := getCurrentCommit()
-		if err != nil {
-			logError(fmt.Sprintf("Failed to get new commit: %v", err))
-			os.Exit(1)
-		}
-		changedProjects = detectChangedProjects(oldCommit, newCommit, config)
-	} else {
-		changedProjects = make(map[string]string)
-	}
-
-	// Compare disk to Arcane - disk is source of truth
-	for _, diskProject := range diskProjects {
-		if len(arcaneProjectsByName[diskProject]) == 0 {
-			// Project exists on disk but not in Arcane - needs to be created
-			projectsToCreate = append(projectsToCreate, diskProject)
-		} else if _, changed := changedProjects[diskProject]; changed {
-			// Project exists in both, but was changed in git - needs to be synced
-			projectsToSync = append(projectsToSync, diskProject)
-		}
+	if config.SyncInterval <= 0 {
+		return errors.New("SYNC_INTERVAL must be positive")
 	}
+	if config.SyncJitter < 0 {
+		return errors.New("SYNC_JITTER must not be negative")
+	}
+	if config.WebhookListen != "" && config.WebhookSecret == "" {
+		return errors.New("WEBHOOK_SECRET is required when WEBHOOK_LISTEN is set")
+	}
+	if config.WebhookDebounce < 0 {
+		return errors.New("WEBHOOK_DEBOUNCE must not be negative")
+	}
+	return nil
+}
 
-	if len(projectsToCreate) == 0 && len(projectsToSync) == 0 {
-		logSuccess("All projects are in sync, no changes needed")
-		return
-	}
-
-	// Create missing projects
-	if len(projectsToCreate) > 0 {
-		logInfo(fmt.Sprintf("Creating %d new project(s) in Arcane...", len(projectsToCreate)))
-		for _, projectName := range projectsToCreate {
-			projectPath := filepath.Join(config.RepoPath, projectName)
-			composeFilePath := findComposeFile(projectPath)
-			if composeFilePath == "" {
-				logWarning(fmt.Sprintf("No compose file found for project %s, skipping", projectName))
-				continue
-			}
-
-			// Read compose file content
-			composeContent, err := os.ReadFile(composeFilePath)
-			if err != nil {
-				logError(fmt.Sprintf("Failed to read compose file for project %s: %v", projectName, err))
-				continue
-			}
-
-			// Read optional .env file
-			envContent := ""
-			envFilePath := filepath.Join(projectPath, ".env")
-			if envData, err := os.ReadFile(envFilePath); err == nil {
-				envContent = string(envData)
-			}
-
-			// Guard: double-check with server-side search to avoid creating duplicates
-			existing, err := arcane.FindProjectsByNameExact(projectName)
-			if err != nil {
-				logWarning(fmt.Sprintf("Could not verify whether project %s exists (will attempt create): %v", projectName, err))
-			} else if len(existing) > 0 {
-				var ids []string
-				for _, p := range existing {
-					ids = append(ids, p.ID)
-				}
-				logWarning(fmt.Sprintf("Project %s already exists in Arcane (IDs: %s). Skipping create to avoid duplicates.", projectName, strings.Join(ids, ", ")))
-				arcaneProjectsByName[projectName] = existing
-				continue
-			}
-
-			logInfo(fmt.Sprintf("Creating project: %s", projectName))
-			projectID, err := arcane.CreateProject(projectName, string(composeContent), envContent)
-			if err != nil {
-				logError(fmt.Sprintf("Failed to create project %s: %v", projectName, err))
-				continue
-			}
-			logSuccess(fmt.Sprintf("Created project: %s (ID: %s)", projectName, projectID))
-
-			// Start the newly created project
-			logInfo(fmt.Sprintf("Starting project: %s", projectName))
-			if err := arcane.StartProject(projectID); err != nil {
-				logWarning(fmt.Sprintf("Failed to start project %s (ID: %s): %v", projectName, projectID, err))
-				// Try redeploy as fallback
-				if err := arcane.RedeployProject(projectID); err != nil {
-					logError(fmt.Sprintf("Failed to redeploy project %s (ID: %s): %v", projectName, projectID, err))
-				} else {
-					logSuccess(fmt.Sprintf("Redeployed project: %s", projectName))
-				}
-			} else {
-				logSuccess(fmt.Sprintf("Started project: %s", projectName))
-			}
-
-			// Update our in-memory index so the rest of the run can resolve IDs
-			arcaneProjectsByName[projectName] = []ArcaneProject{{ID: projectID, Name: projectName}}
-		}
+// reloadConfig re-reads the config file, letting its values replace the ones
+// the process was started with.
+func reloadConfig() (Config, error) {
+	if err := applyConfigFile(true); err != nil {
+		return Config{}, err
 	}
+	return loadConfig()
+}
 
-	// Sync changed projects
-	if len(projectsToSync) > 0 {
-		logInfo(fmt.Sprintf("Syncing %d changed project(s)...", len(projectsToSync)))
-		for _, projectName := range projectsToSync {
-			projectID := projectName
-			if candidates := arcaneProjectsByName[projectName]; len(candidates) > 0 {
-				projectID = selectPreferredProjectID(candidates)
-			} else {
-				logWarning(fmt.Sprintf("Could not resolve Arcane project ID for %s, using name as fallback", projectName))
-			}
-
-			projectPath := filepath.Join(config.RepoPath, projectName)
-			composeFilePath := findComposeFile(projectPath)
-			if composeFilePath == "" {
-				logWarning(fmt.Sprintf("No compose file found for project %s, skipping sync", projectName))
-				continue
-			}
-
-			// Read compose file content
-			composeContent, err := os.ReadFile(composeFilePath)
-			if err != nil {
-				logError(fmt.Sprintf("Failed to read compose file for project %s: %v", projectName, err))
-				continue
-			}
-
-			// Read optional .env file
-			envContent := ""
-			envFilePath := filepath.Join(projectPath, ".env")
-			if envData, err := os.ReadFile(envFilePath); err == nil {
-				envContent = string(envData)
-			}
-
-			// Update project configuration in Arcane
-			logInfo(fmt.Sprintf("Updating project configuration: %s", projectName))
-			if err := arcane.UpdateProject(projectID, string(composeContent), envContent); err != nil {
-				logWarning(fmt.Sprintf("Failed to update project %s (ID: %s) config: %v", projectName, projectID, err))
-			}
-
-			// Redeploy the project
-			logInfo(fmt.Sprintf("Redeploying project: %s", projectName))
-			if err := arcane.RedeployProject(projectID); err != nil {
-				logError(fmt.Sprintf("Failed to redeploy project %s (ID: %s): %v", projectName, projectID, err))
-			} else {
-				logSuccess(fmt.Sprintf("Redeployed project: %s", projectName))
-			}
-		}
+// applyConfigFile loads CONFIG_FILE into the environment. The default file is
+// optional (and usually root-only), so failing to read it is not an error.
+func applyConfigFile(override bool) error {
+	configFile, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		configFile = defaultConfigFile
 	}
 
-	logSuccess("Compose sync completed successfully!")
+	err := loadEnvFile(configFile, override)
+	var pathErr *fs.PathError
+	if err != nil && !explicit && errors.As(err, &pathErr) {
+		return nil
+	}
+	return err
 }
 
-func listDiskProjects(config Config) ([]string, error) {
-	var projects []string
-
-	entries, err := os.ReadDir(config.RepoPath)
+// loadEnvFile reads KEY=VALUE lines (the systemd EnvironmentFile format) into
+// the process environment. Existing variables are kept unless override is set.
+func loadEnvFile(path string, override bool) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read projects directory: %w", err)
+		return err
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
 
-		// Skip hidden directories and syncTool
-		if strings.HasPrefix(entry.Name(), ".") || entry.Name() == "syncTool" {
+		if _, exists := os.LookupEnv(key); exists && !override {
 			continue
 		}
-
-		projectPath := filepath.Join(config.RepoPath, entry.Name())
-
-		// Check if this folder contains a compose file
-		if findComposeFile(projectPath) != "" {
-			projects = append(projects, entry.Name())
+		if cliOverrides[key] {
+			// Command-line flags win over the config file, also on reload
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, i+1, err)
 		}
 	}
-
-	return projects, nil
+	return nil
 }
 
+// composeFileNames are the compose file names Docker Compose looks for, in order of preference.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
 func findComposeFile(projectPath string) string {
-	composeFiles := []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
-	for _, cf := range composeFiles {
+	for _, cf := range composeFileNames {
 		fullPath := filepath.Join(projectPath, cf)
 		if _, err := os.Stat(fullPath); err == nil {
 			return fullPath
@@ -654,12 +295,16 @@ func findComposeFile(projectPath string) string {
 	return ""
 }
 
-func selectPreferredProjectID(candidates []ArcaneProject) string {
+func selectPreferredProjectID(candidates []arcane.Project) string {
+	return selectPreferredProject(candidates).ID
+}
+
+func selectPreferredProject(candidates []arcane.Project) arcane.Project {
 	if len(candidates) == 0 {
-		return ""
+		return arcane.Project{}
 	}
 	if len(candidates) == 1 {
-		return candidates[0].ID
+		return candidates[0]
 	}
 
 	// Prefer the most recently updated project (best effort).
@@ -681,10 +326,10 @@ func selectPreferredProjectID(candidates []ArcaneProject) string {
 	}
 
 	if best.ID != "" {
-		return best.ID
+		return best
 	}
 	// Fallback
-	return candidates[0].ID
+	return candidates[0]
 }
 
 func parseArcaneTime(value string) time.Time {
@@ -701,8 +346,20 @@ func parseArcaneTime(value string) time.Time {
 	return time.Time{}
 }
 
-func getCurrentBranch() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+// gitCommand prepares a git command bound to ctx. Cancelling ctx interrupts
+// git rather than killing it, so it can remove its lock files on the way out.
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = gitEnviron()
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
+	return cmd
+}
+
+func getCurrentBranch(ctx context.Context) (string, error) {
+	cmd := gitCommand(ctx, "rev-parse", "--abbrev-ref", "HEAD")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -710,11 +367,11 @@ func getCurrentBranch() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
-func getGitStatus(branch string) (*GitStatus, error) {
+func getGitStatus(ctx context.Context, branch string) (*GitStatus, error) {
 	status := &GitStatus{}
 
 	// Get ahead/behind counts
-	cmd := exec.Command("git", "rev-list", "--left-right", "--count", fmt.Sprintf("origin/%s...HEAD", branch))
+	cmd := gitCommand(ctx, "rev-list", "--left-right", "--count", fmt.Sprintf("origin/%s...HEAD", branch))
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rev-list: %w", err)
@@ -732,7 +389,7 @@ func getGitStatus(branch string) (*GitStatus, error) {
 	}
 
 	// Check for local changes
-	cmd = exec.Command("git", "status", "--porcelain")
+	cmd = gitCommand(ctx, "status", "--porcelain")
 	output, err = cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to check status: %w", err)
@@ -742,20 +399,35 @@ func getGitStatus(branch string) (*GitStatus, error) {
 	return status, nil
 }
 
-func runGitCommand(args ...string) error {
-	cmd := exec.Command("git", args...)
+func runGitCommand(ctx context.Context, args ...string) error {
+	cmd := gitCommand(ctx, args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = consoleOutput
 
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("git %s: %w", args[0], ctx.Err())
+		}
+		if hint := sshHostKeyHint(stderr.String()); hint != "" {
+			return fmt.Errorf("%w: %s", err, hint)
+		}
 		return fmt.Errorf("%w: %s", err, stderr.String())
 	}
 	return nil
 }
 
-func getCurrentCommit() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "HEAD")
+func getCurrentCommit(ctx context.Context) (string, error) {
+	cmd := gitCommand(ctx, "rev-parse", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func resolveCommit(ctx context.Context, rev string) (string, error) {
+	cmd := gitCommand(ctx, "rev-parse", "--verify", rev+"^{commit}")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -763,7 +435,16 @@ func getCurrentCommit() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
-func detectChangedProjects(oldCommit, newCommit string, config Config) map[string]string {
+func readFileAtCommit(ctx context.Context, commit, path string) (string, error) {
+	cmd := gitCommand(ctx, "show", fmt.Sprintf("%s:%s", commit, path))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+func detectChangedProjects(ctx context.Context, oldCommit, newCommit string, config Config, projects []string) map[string]string {
 	changedProjects := make(map[string]string)
 
 	// If commits are the same, no changes
@@ -772,7 +453,7 @@ func detectChangedProjects(oldCommit, newCommit string, config Config) map[strin
 	}
 
 	// Get list of changed files between commits
-	cmd := exec.Command("git", "diff", "--name-only", oldCommit, newCommit)
+	cmd := gitCommand(ctx, "diff", "--name-only", oldCommit, newCommit)
 	output, err := cmd.Output()
 	if err != nil {
 		logError(fmt.Sprintf("Failed to get changed files: %v", err))
@@ -791,20 +472,23 @@ func detectChangedProjects(oldCommit, newCommit string, config Config) map[strin
 
 		logInfo(fmt.Sprintf("Changed file: %s", file))
 
-		// Check if this is a compose.yaml file
-		filename := filepath.Base(file)
-		if filename != "compose.yaml" && filename != "compose.yml" && filename != "docker-compose.yaml" && filename != "docker-compose.yml" {
+		// Files outside the project folders belong to no project
+		projectName, relPath, found := projectForFile(projects, file)
+		if !found {
 			continue
 		}
 
-		// Get the parent directory (project folder name)
-		dir := filepath.Dir(file)
-		projectName := filepath.Base(dir)
+		// Compose and .env are what Arcane receives, so they always count;
+		// other files (Dockerfiles, mounted config, ...) go through the
+		// filter. The settings file is read on every run and never counts.
+		if relPath == projectSettingsFile || !isProjectPayloadFile(relPath) && !config.SyncFilter.Matches(relPath) {
+			continue
+		}
 
-		// The project name is simply the folder name (e.g., "zerobyte")
-		// This matches the Arcane project name
+		if _, seen := changedProjects[projectName]; !seen {
+			logInfo(fmt.Sprintf("Detected change in project: %s", projectName))
+		}
 		changedProjects[projectName] = projectName
-		logInfo(fmt.Sprintf("Detected change in project: %s", projectName))
 	}
 
 	return changedProjects
@@ -830,25 +514,25 @@ func setupLogging(logFile string) {
 
 func logInfo(msg string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Printf("%s[INFO]%s %s - %s\n", colorBlue, colorReset, timestamp, msg)
+	fmt.Fprintf(consoleOutput, "%s[INFO]%s %s - %s\n", colorBlue, colorReset, timestamp, msg)
 	log.Printf("[INFO] %s", msg)
 }
 
 func logSuccess(msg string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Printf("%s[SUCCESS]%s %s - %s\n", colorGreen, colorReset, timestamp, msg)
+	fmt.Fprintf(consoleOutput, "%s[SUCCESS]%s %s - %s\n", colorGreen, colorReset, timestamp, msg)
 	log.Printf("[SUCCESS] %s", msg)
 }
 
 func logWarning(msg string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Printf("%s[WARNING]%s %s - %s\n", colorYellow, colorReset, timestamp, msg)
+	fmt.Fprintf(consoleOutput, "%s[WARNING]%s %s - %s\n", colorYellow, colorReset, timestamp, msg)
 	log.Printf("[WARNING] %s", msg)
 }
 
 func logError(msg string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Printf("%s[ERROR]%s %s - %s\n", colorRed, colorReset, timestamp, msg)
+	fmt.Fprintf(consoleOutput, "%s[ERROR]%s %s - %s\n", colorRed, colorReset, timestamp, msg)
 	log.Printf("[ERROR] %s", msg)
 }
 
@@ -859,57 +543,52 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-func setupGitAuth(authMethod, sshKeyPath, httpsToken string) {
-	authMethod = strings.ToLower(authMethod)
-
-	switch authMethod {
-	case "ssh":
-		setupGitSSH(sshKeyPath)
-	case "https":
-		setupGitHTTPS(httpsToken)
-	default:
-		logWarning(fmt.Sprintf("Unknown git auth method: %s, defaulting to SSH", authMethod))
-		setupGitSSH(sshKeyPath)
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
 }
 
-func setupGitSSH(keyPath string) {
-	// Check if SSH key exists
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		logWarning(fmt.Sprintf("SSH key not found at %s, git operations may fail", keyPath))
-		return
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-
-	// Set GIT_SSH_COMMAND to use the specified SSH key
-	// This tells git to use this key for all SSH operations
-	sshCommand := fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=/dev/null", keyPath)
-	if err := os.Setenv("GIT_SSH_COMMAND", sshCommand); err != nil {
-		logWarning(fmt.Sprintf("failed to set GIT_SSH_COMMAND environment variable: %v", err))
-		return
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logWarning(fmt.Sprintf("Invalid duration for %s: %q, using default %s", key, value, defaultValue))
+		return defaultValue
 	}
-
-	logInfo(fmt.Sprintf("Configured git to use SSH key: %s", keyPath))
+	return parsed
 }
 
-func setupGitHTTPS(token string) {
-	if token == "" {
-		logWarning("GitHub personal access token not provided, git HTTPS operations may fail")
-		return
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-
-	// Configure git to use the token for HTTPS authentication
-	// Format: https://<token>@github.com/<user>/<repo>.git
-	// We use git credential helper to store the token
-	if err := os.Setenv("GIT_ASKPASS", "true"); err != nil {
-		logWarning(fmt.Sprintf("failed to set GIT_ASKPASS: %v", err))
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logWarning(fmt.Sprintf("Invalid boolean for %s: %q, using default %t", key, value, defaultValue))
+		return defaultValue
 	}
+	return parsed
+}
 
-	// Create a temporary git credential helper script that provides the token
-	credentialHelper := fmt.Sprintf("printf '%s'", token)
-	if err := os.Setenv("GIT_ASKPASS_SUDO", credentialHelper); err != nil {
-		logWarning(fmt.Sprintf("failed to set credential helper: %v", err))
-		return
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-
-	logInfo("Configured git to use HTTPS with personal access token")
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logWarning(fmt.Sprintf("Invalid integer for %s: %q, using default %d", key, value, defaultValue))
+		return defaultValue
+	}
+	return parsed
 }
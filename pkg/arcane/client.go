@@ -0,0 +1,244 @@
+package arcane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent is sent unless WithUserAgent says otherwise.
+const DefaultUserAgent = "arcane-gitops-client"
+
+// Client talks to the Arcane API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	auth       func(*http.Request)
+	retry      RetryPolicy
+	onRetry    func(err error, attempt int, delay time.Duration)
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for requests, e.g. for custom TLS
+// settings or a proxy. The default has a 60 second timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithAPIKey authenticates with an Arcane API key. The key is sent both as
+// X-Api-Key and as a bearer token, which covers every Arcane version.
+func WithAPIKey(key string) Option {
+	return WithAuthFunc(func(req *http.Request) {
+		req.Header.Set("X-Api-Key", key)
+		req.Header.Set("Authorization", "Bearer "+key)
+	})
+}
+
+// WithBearerToken authenticates with a bearer token, e.g. a session token.
+func WithBearerToken(token string) Option {
+	return WithAuthFunc(func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	})
+}
+
+// WithAuthFunc authenticates every request with a custom function, e.g. for
+// credentials added by a reverse proxy in front of Arcane.
+func WithAuthFunc(auth func(*http.Request)) Option {
+	return func(c *Client) { c.auth = auth }
+}
+
+// WithRetryPolicy sets how transient failures are retried. A policy with
+// MaxAttempts 1 disables retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// WithRetryHook registers a function called before each retry with the
+// error that caused it, the number of the upcoming attempt and the delay
+// before it.
+func WithRetryHook(hook func(err error, attempt int, delay time.Duration)) Option {
+	return func(c *Client) { c.onRetry = hook }
+}
+
+// New returns a client for the Arcane instance at baseURL (e.g.
+// http://localhost:3552).
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		userAgent:  DefaultUserAgent,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// response is the envelope Arcane wraps its results in.
+type response[T any] struct {
+	Success    bool       `json:"success"`
+	Data       T          `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Pagination describes a page of a list response.
+type Pagination struct {
+	CurrentPage     int `json:"currentPage"`
+	GrandTotalItems int `json:"grandTotalItems"`
+	ItemsPerPage    int `json:"itemsPerPage"`
+	TotalItems      int `json:"totalItems"`
+	TotalPages      int `json:"totalPages"`
+}
+
+// listAll collects every page of a list endpoint.
+func listAll[T any](ctx context.Context, c *Client, path string, query url.Values) ([]T, error) {
+	const pageSize = 50
+	all := []T{}
+
+	for start := 0; ; start += pageSize {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("start", strconv.Itoa(start))
+		q.Set("limit", strconv.Itoa(pageSize))
+
+		var page response[[]T]
+		if err := c.do(ctx, http.MethodGet, path+"?"+q.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Data...)
+
+		// Stop on the last page (fewer items than requested), or once the
+		// total reported by the pagination has been collected
+		if len(page.Data) < pageSize {
+			return all, nil
+		}
+		total := page.Pagination.GrandTotalItems
+		if total == 0 {
+			total = page.Pagination.TotalItems
+		}
+		if total > 0 && len(all) >= total {
+			return all, nil
+		}
+	}
+}
+
+// do sends a request, retrying transient failures according to the retry
+// policy, and decodes the response into out unless it is nil. Error
+// responses are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	var jsonData []byte
+	if body != nil {
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		respBody, status, header, err := c.attempt(ctx, method, c.baseURL+endpoint, jsonData)
+		if err == nil && status < 400 {
+			if out == nil {
+				return nil
+			}
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("failed to parse response of %s %s: %w", method, endpoint, err)
+			}
+			return nil
+		}
+
+		var failure error
+		if err != nil {
+			failure = fmt.Errorf("request failed on %s %s: %w", method, endpoint, err)
+		} else {
+			failure = newAPIError(method, endpoint, status, respBody)
+		}
+		if ctx.Err() != nil || attempt >= c.retry.MaxAttempts || !retryable(method, status, err) {
+			return failure
+		}
+
+		delay := c.retry.backoff(attempt)
+		if wait, ok := retryAfter(header.Get("Retry-After")); ok {
+			if wait > c.retry.MaxDelay {
+				// The server wants more time than we're willing to wait
+				return failure
+			}
+			delay = wait
+		}
+		if c.onRetry != nil {
+			c.onRetry(failure, attempt+1, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return failure
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt performs a single HTTP round trip.
+func (c *Client) attempt(ctx context.Context, method, url string, jsonData []byte) ([]byte, int, http.Header, error) {
+	var reqBody io.Reader
+	if jsonData != nil {
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.auth != nil {
+		c.auth(req)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if jsonData != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, http.Header{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore close errors
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, resp.Header, fmt.Errorf("failed to read response: %w", err)
+	}
+	return respBody, resp.StatusCode, resp.Header, nil
+}
+
+// projectPath is the API path of a project, or of one of its actions.
+func projectPath(envID, projectID string, action ...string) string {
+	path := "/api/environments/" + url.PathEscape(envID) + "/projects"
+	if projectID != "" {
+		path += "/" + url.PathEscape(projectID)
+	}
+	for _, a := range action {
+		path += "/" + a
+	}
+	return path
+}
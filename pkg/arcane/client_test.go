@@ -0,0 +1,95 @@
+package arcane
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly, so tests don't wait.
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+// recordedRequest is a request as the test server received it.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   string
+}
+
+// testAPI is an Arcane API served by a handler, recording every request.
+type testAPI struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+// newTestAPI starts a server answering with handler and returns a client for
+// it. Extra options are applied after the test defaults.
+func newTestAPI(t *testing.T, handler http.HandlerFunc, opts ...Option) (*Client, *testAPI) {
+	t.Helper()
+	api := &testAPI{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		api.mu.Lock()
+		api.requests = append(api.requests, recordedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone(), Body: string(body)})
+		api.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	opts = append([]Option{WithAPIKey("key"), WithRetryPolicy(testRetryPolicy)}, opts...)
+	return New(server.URL+"/", opts...), api
+}
+
+// recorded returns the requests received so far.
+func (a *testAPI) recorded() []recordedRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]recordedRequest(nil), a.requests...)
+}
+
+// testContext bounds the API calls of a test.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// respond answers every request with status and body.
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	client, api := newTestAPI(t, respond(http.StatusOK, `{"success":true}`), WithUserAgent("arcane-gitops/test"))
+	if err := client.UpdateProject(testContext(t), "0", "p1", UpdateProjectRequest{ComposeContent: "services: {}\n"}); err != nil {
+		t.Fatal(err)
+	}
+	header := api.recorded()[0].Header
+	for key, want := range map[string]string{
+		"X-Api-Key":     "key",
+		"Authorization": "Bearer key",
+		"User-Agent":    "arcane-gitops/test",
+		"Accept":        "application/json",
+		"Content-Type":  "application/json",
+	} {
+		if got := header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestClientDecodeFailure(t *testing.T) {
+	client, _ := newTestAPI(t, respond(http.StatusOK, `<html>login</html>`))
+	if _, err := client.GetProject(testContext(t), "0", "p1"); err == nil {
+		t.Error("GetProject accepted a response that isn't JSON")
+	}
+}
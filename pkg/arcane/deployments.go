@@ -0,0 +1,87 @@
+package arcane
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// DeployOptions control a deploy.
+type DeployOptions struct {
+	Pull bool `json:"pull"` // Pull images before starting containers
+}
+
+// StartProject brings a project's containers up (docker compose up).
+func (c *Client) StartProject(ctx context.Context, envID, projectID string) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "up"), nil, nil)
+}
+
+// DeployProject deploys a project's current content.
+func (c *Client) DeployProject(ctx context.Context, envID, projectID string, opts DeployOptions) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "deploy"), opts, nil)
+}
+
+// RedeployProject recreates a project's containers from its current content,
+// pulling images first.
+func (c *Client) RedeployProject(ctx context.Context, envID, projectID string) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "redeploy"), nil, nil)
+}
+
+// DownProject stops and removes a project's containers (docker compose
+// down). Volumes are kept.
+func (c *Client) DownProject(ctx context.Context, envID, projectID string) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "down"), nil, nil)
+}
+
+// RestartProject restarts a project's containers without recreating them.
+func (c *Client) RestartProject(ctx context.Context, envID, projectID string) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "restart"), nil, nil)
+}
+
+// PullImages pulls the images of a project's services. Running containers
+// keep their current images until the project is redeployed.
+func (c *Client) PullImages(ctx context.Context, envID, projectID string) error {
+	return c.do(ctx, http.MethodPost, projectPath(envID, projectID, "pull"), nil, nil)
+}
+
+// WaitForProject polls a project every interval until done returns true,
+// and returns the project as last seen. Bound the wait with ctx; when it
+// ends first, the error wraps ctx.Err(), also if it ends during a poll.
+func (c *Client) WaitForProject(ctx context.Context, envID, projectID string, interval time.Duration, done func(*Project) bool) (*Project, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *Project
+	stillWaiting := func() error {
+		return fmt.Errorf("project %s is still %q: %w", last.Name, last.Status, ctx.Err())
+	}
+	for {
+		project, err := c.GetProject(ctx, envID, projectID)
+		if err != nil {
+			if last != nil && ctx.Err() != nil {
+				return last, stillWaiting()
+			}
+			return nil, err
+		}
+		last = project
+		if done(project) {
+			return project, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return project, stillWaiting()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForStatus waits until a project reports one of statuses, e.g.
+// StatusRunning after a deploy.
+func (c *Client) WaitForStatus(ctx context.Context, envID, projectID string, interval time.Duration, statuses ...string) (*Project, error) {
+	return c.WaitForProject(ctx, envID, projectID, interval, func(p *Project) bool {
+		return slices.Contains(statuses, p.Status)
+	})
+}
@@ -0,0 +1,93 @@
+package arcane
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeploymentRequests(t *testing.T) {
+	ctx := testContext(t)
+	tests := []struct {
+		call   func(*Client) error
+		action string
+		body   string
+	}{
+		{func(c *Client) error { return c.StartProject(ctx, "0", "p1") }, "up", ""},
+		{func(c *Client) error { return c.DeployProject(ctx, "0", "p1", DeployOptions{Pull: true}) }, "deploy", `{"pull":true}`},
+		{func(c *Client) error { return c.DeployProject(ctx, "0", "p1", DeployOptions{}) }, "deploy", `{"pull":false}`},
+		{func(c *Client) error { return c.RedeployProject(ctx, "0", "p1") }, "redeploy", ""},
+		{func(c *Client) error { return c.DownProject(ctx, "0", "p1") }, "down", ""},
+		{func(c *Client) error { return c.RestartProject(ctx, "0", "p1") }, "restart", ""},
+		{func(c *Client) error { return c.PullImages(ctx, "0", "p1") }, "pull", ""},
+	}
+	for _, tt := range tests {
+		client, api := newTestAPI(t, respond(http.StatusOK, `{"success":true}`))
+		if err := tt.call(client); err != nil {
+			t.Fatalf("%s: %v", tt.action, err)
+		}
+		r := api.recorded()[0]
+		if path := "/api/environments/0/projects/p1/" + tt.action; r.Method != http.MethodPost || r.Path != path || r.Body != tt.body {
+			t.Errorf("request = %s %s %q, want POST %s %q", r.Method, r.Path, r.Body, path, tt.body)
+		}
+	}
+}
+
+// statusSequence reports the project with each status in turn, then keeps
+// reporting the last.
+func statusSequence(statuses ...string) http.HandlerFunc {
+	var calls atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := min(int(calls.Add(1)), len(statuses)) - 1
+		respond(http.StatusOK, `{"success":true,"data":{"id":"p1","name":"web","status":"`+statuses[i]+`"}}`)(w, r)
+	}
+}
+
+func TestWaitForStatus(t *testing.T) {
+	client, api := newTestAPI(t, statusSequence(StatusStopped, StatusPartiallyRunning, StatusRunning))
+	project, err := client.WaitForStatus(testContext(t), "0", "p1", time.Millisecond, StatusRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Status != StatusRunning || len(api.recorded()) != 3 {
+		t.Errorf("WaitForStatus = %q after %d polls, want running after 3", project.Status, len(api.recorded()))
+	}
+
+	// Any of the statuses will do
+	client, api = newTestAPI(t, statusSequence(StatusStopped))
+	if project, err := client.WaitForStatus(testContext(t), "0", "p1", time.Millisecond, StatusRunning, StatusStopped); err != nil || project.Status != StatusStopped {
+		t.Errorf("WaitForStatus = %v, %v, want stopped", project, err)
+	}
+	if len(api.recorded()) != 1 {
+		t.Errorf("%d polls, want 1", len(api.recorded()))
+	}
+}
+
+func TestWaitForProjectTimeout(t *testing.T) {
+	client, _ := newTestAPI(t, statusSequence(StatusStopped))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	project, err := client.WaitForProject(ctx, "0", "p1", 5*time.Millisecond, func(p *Project) bool { return p.Status == StatusRunning })
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), `web is still "stopped"`) {
+		t.Errorf("err = %v, want the deadline and the last status", err)
+	}
+	if project == nil || project.Status != StatusStopped {
+		t.Errorf("project = %+v, want it as last seen", project)
+	}
+}
+
+func TestWaitForProjectError(t *testing.T) {
+	client, api := newTestAPI(t, respond(http.StatusNotFound, `{"success":false,"error":"project not found"}`))
+	_, err := client.WaitForProject(testContext(t), "0", "p1", time.Millisecond, func(*Project) bool { return true })
+	if !IsNotFound(err) {
+		t.Errorf("err = %v, want the 404", err)
+	}
+	if len(api.recorded()) != 1 {
+		t.Errorf("%d polls, want 1", len(api.recorded()))
+	}
+}
@@ -0,0 +1,23 @@
+// Package arcane is a client for the Arcane Docker management API
+// (https://getarcane.app). It is the client arcane-gitops itself
+// uses to reconcile compose projects.
+//
+// Projects live in an environment, so project and deployment methods take
+// the environment ID ("0" is the local Docker host):
+//
+//	client := arcane.New("http://localhost:3552",
+//		arcane.WithAPIKey(os.Getenv("ARCANE_API_KEY")),
+//		arcane.WithUserAgent("my-tool/1.0"))
+//
+//	projects, err := client.ListProjects(ctx, "0")
+//	if err != nil {
+//		return err
+//	}
+//	for _, p := range projects {
+//		fmt.Println(p.Name, p.Status)
+//	}
+//
+// Transient failures (network errors, 429, 5xx) are retried according to a
+// RetryPolicy; POST actions only when Arcane can't have acted on them. Error
+// responses are returned as *APIError.
+package arcane
@@ -0,0 +1,31 @@
+package arcane
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Environment is a Docker host managed by Arcane. The local host is
+// environment "0"; others are reached through an Arcane agent.
+type Environment struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	APIURL  string `json:"apiUrl"`
+	Status  string `json:"status"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ListEnvironments returns every environment.
+func (c *Client) ListEnvironments(ctx context.Context) ([]Environment, error) {
+	return listAll[Environment](ctx, c, "/api/environments", nil)
+}
+
+// GetEnvironment returns a single environment.
+func (c *Client) GetEnvironment(ctx context.Context, envID string) (*Environment, error) {
+	var resp response[Environment]
+	if err := c.do(ctx, http.MethodGet, "/api/environments/"+url.PathEscape(envID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
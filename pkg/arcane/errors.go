@@ -0,0 +1,90 @@
+package arcane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is a non-2xx response from the Arcane API. Use errors.As to get at
+// the status code, or IsNotFound for the common "already gone" case.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Endpoint   string
+	// Message is Arcane's error message, or the raw body if it couldn't be decoded
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d) on %s %s: %s", e.StatusCode, e.Method, e.Endpoint, e.Message)
+}
+
+// IsNotFound reports whether err is an Arcane 404.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func newAPIError(method, endpoint string, status int, body []byte) *APIError {
+	message := decodeErrorMessage(body)
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &APIError{
+		StatusCode: status,
+		Method:     method,
+		Endpoint:   endpoint,
+		Message:    message,
+	}
+}
+
+// decodeErrorMessage extracts the message from Arcane's error responses,
+// which are either {"success":false,"error":"..."} or RFC 9457 problem
+// details with "detail" and per-field "errors".
+func decodeErrorMessage(body []byte) string {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Title   string          `json:"title"`
+		Detail  string          `json:"detail"`
+		Errors  []struct {
+			Message  string `json:"message"`
+			Location string `json:"location"`
+		} `json:"errors"`
+	}
+	raw := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &payload); err != nil {
+		if len(raw) > 500 {
+			raw = raw[:500] + "..."
+		}
+		return raw
+	}
+
+	var parts []string
+	var errorText string
+	if json.Unmarshal(payload.Error, &errorText) == nil && errorText != "" {
+		parts = append(parts, errorText)
+	}
+	for _, text := range []string{payload.Message, payload.Detail} {
+		if text != "" && text != errorText {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 && payload.Title != "" {
+		parts = append(parts, payload.Title)
+	}
+	for _, fieldErr := range payload.Errors {
+		if fieldErr.Location != "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", fieldErr.Location, fieldErr.Message))
+		} else if fieldErr.Message != "" {
+			parts = append(parts, fieldErr.Message)
+		}
+	}
+	if len(parts) == 0 {
+		return raw
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,68 @@
+package arcane
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeErrorMessage(t *testing.T) {
+	long := strings.Repeat("x", 600)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"envelope", `{"success":false,"error":"project not found"}`, "project not found"},
+		{"envelope with message", `{"success":false,"error":"deploy failed","message":"image not found"}`, "deploy failed; image not found"},
+		{"repeated message", `{"error":"deploy failed","message":"deploy failed"}`, "deploy failed"},
+		{"error object", `{"error":{"code":42},"message":"bad request"}`, "bad request"},
+		{
+			"problem details",
+			`{"title":"Unprocessable Entity","status":422,"detail":"validation failed","errors":[{"message":"is required","location":"body.name"},{"message":"too long"}]}`,
+			"validation failed; body.name: is required; too long",
+		},
+		{"problem title only", `{"title":"Not Found","status":404}`, "Not Found"},
+		{"unknown JSON", `{"status":"error"}`, `{"status":"error"}`},
+		{"plain text", "Bad Gateway\n", "Bad Gateway"},
+		{"long plain text", long, long[:500] + "..."},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := decodeErrorMessage([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: decodeErrorMessage = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	client, _ := newTestAPI(t, respond(http.StatusNotFound, `{"success":false,"error":"project not found"}`))
+	_, err := client.GetProject(testContext(t), "2", "p1")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an APIError", err)
+	}
+	want := APIError{StatusCode: http.StatusNotFound, Method: http.MethodGet, Endpoint: "/api/environments/2/projects/p1", Message: "project not found"}
+	if *apiErr != want {
+		t.Errorf("APIError = %+v, want %+v", *apiErr, want)
+	}
+	if got := err.Error(); got != "API error (status 404) on GET /api/environments/2/projects/p1: project not found" {
+		t.Errorf("Error() = %q", got)
+	}
+	if !IsNotFound(err) || !IsNotFound(fmt.Errorf("delete: %w", err)) {
+		t.Error("IsNotFound = false for a 404")
+	}
+
+	// Without a body, the status text stands in for the message
+	client, _ = newTestAPI(t, respond(http.StatusConflict, ""))
+	err = client.DownProject(testContext(t), "0", "p1")
+	if !errors.As(err, &apiErr) || apiErr.Message != "Conflict" {
+		t.Errorf("err = %v, want an APIError with message Conflict", err)
+	}
+	if IsNotFound(err) || IsNotFound(errors.New("not found")) {
+		t.Error("IsNotFound = true for an error that isn't a 404")
+	}
+}
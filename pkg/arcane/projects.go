@@ -0,0 +1,121 @@
+package arcane
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Project statuses reported by Arcane.
+const (
+	StatusRunning          = "running"
+	StatusStopped          = "stopped"
+	StatusPartiallyRunning = "partially running"
+	StatusUnknown          = "unknown"
+)
+
+// Project is a compose project managed by Arcane.
+type Project struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	StatusReason   string `json:"statusReason"`
+	DirName        string `json:"dirName"`
+	Path           string `json:"path"`
+	ComposeContent string `json:"composeContent"`
+	EnvContent     string `json:"envContent"`
+	CreatedAt      string `json:"createdAt"`
+	UpdatedAt      string `json:"updatedAt"`
+	// Services is the runtime state of each service's container. Only
+	// GetProject fills it in, and only on Arcane versions that report it.
+	Services []ServiceStatus `json:"runtimeServices,omitempty"`
+}
+
+// ServiceStatus is the state of a service's container.
+type ServiceStatus struct {
+	Name          string `json:"name"`
+	Image         string `json:"image"`
+	Status        string `json:"status"` // Docker state: running, restarting, exited, ...
+	Health        string `json:"health"` // Healthcheck result: healthy, unhealthy, starting, or empty without a healthcheck
+	ContainerID   string `json:"containerId"`
+	ContainerName string `json:"containerName"`
+}
+
+// CreateProjectRequest is the content of a new project.
+type CreateProjectRequest struct {
+	Name           string `json:"name"`
+	ComposeContent string `json:"composeContent"`
+	EnvContent     string `json:"envContent,omitempty"`
+}
+
+// UpdateProjectRequest replaces a project's content. An empty compose file is
+// left unchanged, but the env file is always replaced: an empty EnvContent
+// clears it, as when a project's env files were deleted.
+type UpdateProjectRequest struct {
+	ComposeContent string `json:"composeContent,omitempty"`
+	EnvContent     string `json:"envContent"`
+}
+
+// DeleteOptions control what is removed along with a project.
+type DeleteOptions struct {
+	RemoveFiles   bool `json:"removeFiles"`   // The project directory on the Docker host
+	RemoveVolumes bool `json:"removeVolumes"` // Named volumes, which usually hold application data
+}
+
+// ListProjects returns every project in an environment.
+func (c *Client) ListProjects(ctx context.Context, envID string) ([]Project, error) {
+	return listAll[Project](ctx, c, projectPath(envID, ""), nil)
+}
+
+// GetProject returns a single project, including its content.
+func (c *Client) GetProject(ctx context.Context, envID, projectID string) (*Project, error) {
+	var resp response[Project]
+	if err := c.do(ctx, http.MethodGet, projectPath(envID, projectID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// FindProjectsByName returns the projects named exactly name. Arcane allows
+// duplicates, so there may be more than one.
+func (c *Client) FindProjectsByName(ctx context.Context, envID, name string) ([]Project, error) {
+	projects, err := listAll[Project](ctx, c, projectPath(envID, ""), url.Values{"search": {name}})
+	if err != nil {
+		return nil, err
+	}
+
+	var exact []Project
+	for _, p := range projects {
+		if p.Name == name {
+			exact = append(exact, p)
+		}
+	}
+	return exact, nil
+}
+
+// CreateProject creates a project. It is not started.
+func (c *Client) CreateProject(ctx context.Context, envID string, req CreateProjectRequest) (*Project, error) {
+	var resp response[Project]
+	if err := c.do(ctx, http.MethodPost, projectPath(envID, ""), req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.ID == "" {
+		// Fall back to the name as ID
+		resp.Data.ID = req.Name
+	}
+	if resp.Data.Name == "" {
+		resp.Data.Name = req.Name
+	}
+	return &resp.Data, nil
+}
+
+// UpdateProject replaces a project's compose file and/or env file. Running
+// containers are not touched until the project is redeployed.
+func (c *Client) UpdateProject(ctx context.Context, envID, projectID string, req UpdateProjectRequest) error {
+	return c.do(ctx, http.MethodPut, projectPath(envID, projectID), req, nil)
+}
+
+// DeleteProject destroys a project, taking its containers down first.
+func (c *Client) DeleteProject(ctx context.Context, envID, projectID string, opts DeleteOptions) error {
+	return c.do(ctx, http.MethodDelete, projectPath(envID, projectID, "destroy"), opts, nil)
+}
@@ -0,0 +1,154 @@
+package arcane
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProjectRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(*Client) error
+		method   string
+		path     string
+		body     string // "" for none
+		response string
+	}{
+		{
+			name: "create",
+			call: func(c *Client) error {
+				p, err := c.CreateProject(testContext(t), "2", CreateProjectRequest{Name: "web", ComposeContent: "services: {}\n", EnvContent: "A=1\n"})
+				if err == nil && (p.ID != "p1" || p.Name != "web") {
+					err = fmt.Errorf("created %+v", p)
+				}
+				return err
+			},
+			method:   http.MethodPost,
+			path:     "/api/environments/2/projects",
+			body:     `{"name":"web","composeContent":"services: {}\n","envContent":"A=1\n"}`,
+			response: `{"success":true,"data":{"id":"p1","name":"web"}}`,
+		},
+		{
+			name: "create without env, ID from the name",
+			call: func(c *Client) error {
+				p, err := c.CreateProject(testContext(t), "0", CreateProjectRequest{Name: "web", ComposeContent: "services: {}\n"})
+				if err == nil && (p.ID != "web" || p.Name != "web") {
+					err = fmt.Errorf("created %+v", p)
+				}
+				return err
+			},
+			method:   http.MethodPost,
+			path:     "/api/environments/0/projects",
+			body:     `{"name":"web","composeContent":"services: {}\n"}`,
+			response: `{"success":true,"data":{}}`,
+		},
+		{
+			name: "update",
+			call: func(c *Client) error {
+				return c.UpdateProject(testContext(t), "0", "p1", UpdateProjectRequest{ComposeContent: "services: {}\n", EnvContent: "A=1\n"})
+			},
+			method: http.MethodPut,
+			path:   "/api/environments/0/projects/p1",
+			body:   `{"composeContent":"services: {}\n","envContent":"A=1\n"}`,
+		},
+		{
+			// Deleted env files must clear the env in Arcane
+			name: "update clearing the env",
+			call: func(c *Client) error {
+				return c.UpdateProject(testContext(t), "0", "p1", UpdateProjectRequest{ComposeContent: "services: {}\n"})
+			},
+			method: http.MethodPut,
+			path:   "/api/environments/0/projects/p1",
+			body:   `{"composeContent":"services: {}\n","envContent":""}`,
+		},
+		{
+			name: "delete",
+			call: func(c *Client) error {
+				return c.DeleteProject(testContext(t), "0", "p1", DeleteOptions{RemoveFiles: true})
+			},
+			method: http.MethodDelete,
+			path:   "/api/environments/0/projects/p1/destroy",
+			body:   `{"removeFiles":true,"removeVolumes":false}`,
+		},
+		{
+			name: "get",
+			call: func(c *Client) error {
+				p, err := c.GetProject(testContext(t), "0", "p1")
+				if err == nil && (p.Status != StatusRunning || len(p.Services) != 1 || p.Services[0].Health != "healthy") {
+					err = fmt.Errorf("got %+v", p)
+				}
+				return err
+			},
+			method:   http.MethodGet,
+			path:     "/api/environments/0/projects/p1",
+			response: `{"success":true,"data":{"id":"p1","name":"web","status":"running","runtimeServices":[{"name":"web","status":"running","health":"healthy"}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := tt.response
+			if response == "" {
+				response = `{"success":true}`
+			}
+			client, api := newTestAPI(t, respond(http.StatusOK, response))
+			if err := tt.call(client); err != nil {
+				t.Fatal(err)
+			}
+			requests := api.recorded()
+			if len(requests) != 1 {
+				t.Fatalf("%d requests, want 1", len(requests))
+			}
+			r := requests[0]
+			if r.Method != tt.method || r.Path != tt.path || r.Body != tt.body {
+				t.Errorf("request = %s %s %s, want %s %s %s", r.Method, r.Path, r.Body, tt.method, tt.path, tt.body)
+			}
+		})
+	}
+}
+
+func TestListProjectsPages(t *testing.T) {
+	client, api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		start := r.URL.Query().Get("start")
+		var projects []string
+		switch start {
+		case "0":
+			for i := 0; i < 50; i++ {
+				projects = append(projects, fmt.Sprintf(`{"id":"%d","name":"web"}`, i))
+			}
+		case "50":
+			projects = append(projects, `{"id":"50","name":"web-2"}`)
+		}
+		respond(http.StatusOK, `{"success":true,"data":[`+strings.Join(projects, ",")+`],"pagination":{"totalItems":51}}`)(w, r)
+	})
+
+	projects, err := client.ListProjects(testContext(t), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 51 || projects[50].ID != "50" {
+		t.Errorf("listed %d projects, want 51", len(projects))
+	}
+	var starts []string
+	for _, r := range api.recorded() {
+		query, _ := url.ParseQuery(r.Query)
+		starts = append(starts, query.Get("start")+"/"+query.Get("limit"))
+	}
+	if got := strings.Join(starts, " "); got != "0/50 50/50" {
+		t.Errorf("pages requested (start/limit) = %s, want 0/50 50/50", got)
+	}
+
+	// The search matches parts of names; only exact matches are returned
+	found, err := client.FindProjectsByName(testContext(t), "0", "web-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != "50" {
+		t.Errorf("FindProjectsByName = %+v, want project 50", found)
+	}
+	if query, _ := url.ParseQuery(api.recorded()[2].Query); query.Get("search") != "web-2" {
+		t.Errorf("search = %q, want web-2", query.Get("search"))
+	}
+}
@@ -0,0 +1,70 @@
+package arcane
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how the client retries transient failures.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts per request; 1 disables retries
+	BaseDelay   time.Duration // Delay before the first retry, doubled for each further one
+	MaxDelay    time.Duration // Upper bound for a single delay, also for Retry-After
+}
+
+// DefaultRetryPolicy is used unless WithRetryPolicy says otherwise.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// retryable decides whether a failed attempt may be repeated. Idempotent
+// requests are retried on network errors, 429 and any 5xx. Others (POST) are
+// only retried when the server can't have acted on them: 429 and the
+// gateway/unavailable responses a proxy returns while Arcane restarts.
+func retryable(method string, status int, transportErr error) bool {
+	idempotent := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut || method == http.MethodDelete
+	switch {
+	case transportErr != nil:
+		return idempotent
+	case status == http.StatusTooManyRequests:
+		return true
+	case status >= 500 && idempotent:
+		return true
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// backoff is the delay before retry number attempt (1-based): exponential,
+// capped, with jitter so clients restarted together don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay { // <= 0 after overflow
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Between half and all of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter parses a Retry-After header (seconds or an HTTP date).
+func retryAfter(header string) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,211 @@
+package arcane
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	transportErr := errors.New("connection refused")
+	tests := []struct {
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{http.MethodGet, 0, transportErr, true},
+		{http.MethodPut, 0, transportErr, true},
+		{http.MethodDelete, 0, transportErr, true},
+		{http.MethodPost, 0, transportErr, false}, // May have been acted on
+		{http.MethodGet, http.StatusInternalServerError, nil, true},
+		{http.MethodPut, http.StatusGatewayTimeout, nil, true},
+		{http.MethodPost, http.StatusInternalServerError, nil, false},
+		{http.MethodPost, http.StatusGatewayTimeout, nil, false},
+		{http.MethodPost, http.StatusBadGateway, nil, true},
+		{http.MethodPost, http.StatusServiceUnavailable, nil, true},
+		{http.MethodPost, http.StatusTooManyRequests, nil, true},
+		{http.MethodGet, http.StatusTooManyRequests, nil, true},
+		{http.MethodGet, http.StatusNotFound, nil, false},
+		{http.MethodPut, http.StatusBadRequest, nil, false},
+		{http.MethodGet, http.StatusUnauthorized, nil, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.method, tt.status, tt.err); got != tt.want {
+			t.Errorf("retryable(%s, %d, %v) = %v, want %v", tt.method, tt.status, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration // The delay is between half of this and this
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},  // Capped
+		{70, time.Second}, // Capped after overflowing
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(tt.attempt); delay < tt.max/2 || delay > tt.max {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, delay, tt.max/2, tt.max)
+			}
+		}
+	}
+
+	if delay := (RetryPolicy{MaxAttempts: 3}).backoff(1); delay != 0 {
+		t.Errorf("backoff without a base delay = %s, want 0", delay)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"1.5", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true}, // Already passed
+	}
+	for _, tt := range tests {
+		if got, ok := retryAfter(tt.header); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// HTTP dates are relative to now, and only precise to the second
+	if got, ok := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); !ok || got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(in a minute) = %s, %v", got, ok)
+	}
+}
+
+// failingFor answers status to the first n requests, then succeeds.
+func failingFor(n int, status int, header http.Header) http.HandlerFunc {
+	var calls atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= n {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			respond(status, `{"success":false,"error":"try again"}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"success":true,"data":{"id":"p1","name":"web"}}`)(w, r)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		call     func(*Client) error
+		requests int
+		status   int // Of the returned APIError, 0 for success
+	}{
+		{
+			name:     "GET retried until it succeeds",
+			handler:  failingFor(2, http.StatusServiceUnavailable, nil),
+			call:     func(c *Client) error { _, err := c.GetProject(context.Background(), "0", "p1"); return err },
+			requests: 3,
+		},
+		{
+			name:     "GET gives up after MaxAttempts",
+			handler:  failingFor(5, http.StatusInternalServerError, nil),
+			call:     func(c *Client) error { _, err := c.GetProject(context.Background(), "0", "p1"); return err },
+			requests: 3,
+			status:   http.StatusInternalServerError,
+		},
+		{
+			name:     "POST not retried on 500",
+			handler:  failingFor(1, http.StatusInternalServerError, nil),
+			call:     func(c *Client) error { return c.RedeployProject(context.Background(), "0", "p1") },
+			requests: 1,
+			status:   http.StatusInternalServerError,
+		},
+		{
+			name:     "POST retried on 503",
+			handler:  failingFor(1, http.StatusServiceUnavailable, nil),
+			call:     func(c *Client) error { return c.RedeployProject(context.Background(), "0", "p1") },
+			requests: 2,
+		},
+		{
+			name:     "client errors not retried",
+			handler:  failingFor(1, http.StatusNotFound, nil),
+			call:     func(c *Client) error { return c.UpdateProject(context.Background(), "0", "p1", UpdateProjectRequest{}) },
+			requests: 1,
+			status:   http.StatusNotFound,
+		},
+		{
+			name:     "Retry-After within MaxDelay",
+			handler:  failingFor(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}),
+			call:     func(c *Client) error { return c.StartProject(context.Background(), "0", "p1") },
+			requests: 2,
+		},
+		{
+			name:     "Retry-After beyond MaxDelay",
+			handler:  failingFor(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"120"}}),
+			call:     func(c *Client) error { return c.StartProject(context.Background(), "0", "p1") },
+			requests: 1,
+			status:   http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retries []string
+			client, api := newTestAPI(t, tt.handler, WithRetryHook(func(err error, attempt int, delay time.Duration) {
+				retries = append(retries, strconv.Itoa(attempt))
+				if delay > testRetryPolicy.MaxDelay {
+					t.Errorf("retry %d after %s, beyond MaxDelay", attempt, delay)
+				}
+			}))
+			err := tt.call(client)
+
+			if got := len(api.recorded()); got != tt.requests {
+				t.Errorf("%d request(s), want %d", got, tt.requests)
+			}
+			if len(retries) != tt.requests-1 {
+				t.Errorf("retry hook called for attempts %v, want %d call(s)", retries, tt.requests-1)
+			}
+			var apiErr *APIError
+			switch {
+			case tt.status == 0 && err != nil:
+				t.Errorf("err = %v, want success", err)
+			case tt.status != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.status):
+				t.Errorf("err = %v, want an APIError with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestClientRetryStopsWithContext(t *testing.T) {
+	client, api := newTestAPI(t, failingFor(5, http.StatusServiceUnavailable, nil),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetProject(ctx, "0", "p1")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetProject returned after %s, want it to stop waiting with the context", elapsed)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("err = %v, want the last failure", err)
+	}
+	if got := len(api.recorded()); got != 1 {
+		t.Errorf("%d request(s), want 1", got)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// Actions a sync pass can take for a project
+const (
+	actionCreate   = "create"   // Folder exists but the project is missing in Arcane
+	actionUpdate   = "update"   // Push compose/.env to Arcane, then redeploy
+	actionRedeploy = "redeploy" // Only auxiliary files changed; content in Arcane is current
+	actionPrune    = "prune"    // Folder was removed from the repository
+	actionAdopt    = "adopt"    // Record the project in the sync state without touching Arcane
+)
+
+// PlannedChange is one action a sync pass would take for a project.
+type PlannedChange struct {
+	Project     string   `json:"project"`
+	Action      string   `json:"action"`
+	Reason      string   `json:"reason"`
+	ProjectID   string   `json:"projectId,omitempty"`
+	Environment string   `json:"environment"`
+	ComposeDiff string   `json:"composeDiff,omitempty"`
+	EnvKeys     []string `json:"changedEnvKeys,omitempty"`
+
+	content  *ProjectContent
+	arcane   arcane.Project
+	settings ProjectSettings
+}
+
+// SyncPlan is everything a sync pass would do. Building it has no side
+// effects, so the same plan can be printed (plan command) or applied (sync).
+type SyncPlan struct {
+	Branch       string          `json:"branch,omitempty"`
+	FromCommit   string          `json:"fromCommit,omitempty"`
+	TargetCommit string          `json:"targetCommit"`
+	Changes      []PlannedChange `json:"changes"`
+	Warnings     []PlanMessage   `json:"warnings,omitempty"`
+	// Errors are problems that fail the run, such as a refused prune
+	Errors []PlanMessage `json:"errors,omitempty"`
+	// Moved are sync state entries of folders that were renamed or moved;
+	// their project is deployed from the new folder, so only the entry is
+	// dropped
+	Moved []PlanMessage `json:"moved,omitempty"`
+}
+
+// PlanMessage is a warning or error found while planning. Project is empty
+// for messages that aren't about a single project.
+type PlanMessage struct {
+	Project string `json:"project,omitempty"`
+	Message string `json:"message"`
+}
+
+// projectInventory is what exists on disk and in Arcane at the start of a pass.
+type projectInventory struct {
+	DiskProjects []string
+	// Settings holds every project folder whose settings file is valid
+	Settings map[string]ProjectSettings
+	// Arcane indexes projects by environment ID, then by name (Arcane can
+	// contain duplicates)
+	Arcane map[string]map[string][]arcane.Project
+
+	settingsErrs map[string]error
+	listErrs     map[string]error // Environments whose projects couldn't be listed
+	ignore       *ignoreRules
+	policy       *Policy
+}
+
+// arcaneProjects returns the Arcane projects named name in an environment.
+func (inv *projectInventory) arcaneProjects(envID, name string) []arcane.Project {
+	return inv.Arcane[envID][name]
+}
+
+// listed reports whether an environment's projects are known.
+func (inv *projectInventory) listed(envID string) bool {
+	_, ok := inv.Arcane[envID]
+	return ok
+}
+
+func gatherInventory(ctx context.Context, config Config, client *arcane.Client, state *SyncState) (*projectInventory, error) {
+	rules, err := loadIgnoreRules(config)
+	if err != nil {
+		return nil, err
+	}
+	diskProjects, err := scanDiskProjects(config, rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disk projects: %w", err)
+	}
+	// Read every pass, so a policy kept in the repository applies as pushed
+	policy, err := loadPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+	logInfo(fmt.Sprintf("Found %d project(s) on disk", len(diskProjects)))
+
+	inv := &projectInventory{
+		DiskProjects: diskProjects,
+		Settings:     make(map[string]ProjectSettings),
+		settingsErrs: make(map[string]error),
+		ignore:       rules,
+		policy:       policy,
+	}
+
+	// List every environment a project is, or was, deployed to
+	envIDs := []string{config.ArcaneEnvID}
+	for _, name := range diskProjects {
+		settings, err := loadProjectSettings(config, name)
+		if err != nil {
+			inv.settingsErrs[name] = err
+			continue
+		}
+		inv.Settings[name] = settings
+		if settings.Enabled {
+			envIDs = append(envIDs, settings.EnvID)
+		}
+	}
+	for name, entry := range state.Projects {
+		envIDs = append(envIDs, entry.settings(config, name).EnvID)
+	}
+	sort.Strings(envIDs)
+	envIDs = slices.Compact(envIDs)
+
+	// Continue without the ones that fail; creates are still guarded server-side
+	inv.Arcane, inv.listErrs = listArcaneProjects(ctx, client, envIDs)
+	for _, envID := range envIDs {
+		projects, listed := inv.Arcane[envID]
+		switch {
+		case !listed:
+		case len(envIDs) > 1:
+			logInfo(fmt.Sprintf("Found %d project(s) in Arcane environment %s", countProjects(projects), envID))
+		default:
+			logInfo(fmt.Sprintf("Found %d project(s) in Arcane", countProjects(projects)))
+		}
+	}
+	return inv, nil
+}
+
+// listArcaneProjects lists the projects of each environment, indexed by name.
+// Environments that fail to list are left out and returned with their errors.
+func listArcaneProjects(ctx context.Context, client *arcane.Client, envIDs []string) (map[string]map[string][]arcane.Project, map[string]error) {
+	listed := make(map[string]map[string][]arcane.Project)
+	errs := make(map[string]error)
+	for _, envID := range envIDs {
+		if _, done := listed[envID]; done {
+			continue
+		}
+		projects, err := client.ListProjects(ctx, envID)
+		if err != nil {
+			errs[envID] = err
+			continue
+		}
+		byName := make(map[string][]arcane.Project)
+		for _, p := range projects {
+			byName[p.Name] = append(byName[p.Name], p)
+		}
+		listed[envID] = byName
+	}
+	return listed, errs
+}
+
+func countProjects(byName map[string][]arcane.Project) int {
+	n := 0
+	for _, projects := range byName {
+		n += len(projects)
+	}
+	return n
+}
+
+func (p *SyncPlan) warn(project, msg string) {
+	p.Warnings = append(p.Warnings, PlanMessage{Project: project, Message: msg})
+}
+
+func (p *SyncPlan) fail(project, msg string) {
+	p.Errors = append(p.Errors, PlanMessage{Project: project, Message: msg})
+}
+
+func (p *SyncPlan) add(change PlannedChange) {
+	change.Environment = change.settings.EnvID
+	p.Changes = append(p.Changes, change)
+}
+
+// admit checks content about to be pushed to Arcane: the compose files must
+// be valid and not break a deny rule of the policy. Violations of warn rules
+// are recorded as warnings.
+func (p *SyncPlan) admit(config Config, policy *Policy, name string, content *ProjectContent) bool {
+	project, err := checkCompose(config, name, content)
+	if err != nil {
+		p.fail(name, fmt.Sprintf("Not syncing project %s: %v", name, err))
+		return false
+	}
+
+	admitted := true
+	for _, violation := range policy.evaluate(config, name, project) {
+		if violation.Severity == policyDeny {
+			p.fail(name, fmt.Sprintf("Not syncing project %s: policy violation: %v", name, violation))
+			admitted = false
+		} else {
+			p.warn(name, fmt.Sprintf("Policy warning for project %s: %v", name, violation))
+		}
+	}
+	return admitted
+}
+
+// audit reports what admit would refuse in content the plan leaves as it is
+// in Arcane, as warnings: it is already deployed, and refusing it would not
+// take it down.
+func (p *SyncPlan) audit(config Config, policy *Policy, name string, content *ProjectContent) {
+	project, err := checkCompose(config, name, content)
+	if err != nil {
+		p.warn(name, fmt.Sprintf("Project %s is deployed with an invalid compose file: %v", name, err))
+		return
+	}
+	for _, violation := range policy.evaluate(config, name, project) {
+		msg := fmt.Sprintf("Deployed project %s breaks the policy: %v", name, violation)
+		if violation.Severity == policyDeny {
+			msg += "; its next change will be refused until this is fixed"
+		}
+		p.warn(name, msg)
+	}
+}
+
+// forProject narrows the plan to a single project.
+func (p *SyncPlan) forProject(name string) *SyncPlan {
+	narrowed := &SyncPlan{
+		Branch:       p.Branch,
+		FromCommit:   p.FromCommit,
+		TargetCommit: p.TargetCommit,
+		Changes:      []PlannedChange{},
+	}
+	for _, change := range p.Changes {
+		if change.Project == name {
+			narrowed.Changes = append(narrowed.Changes, change)
+		}
+	}
+	for _, msg := range p.Warnings {
+		if msg.Project == "" || msg.Project == name {
+			narrowed.Warnings = append(narrowed.Warnings, msg)
+		}
+	}
+	for _, msg := range p.Errors {
+		if msg.Project == name {
+			narrowed.Errors = append(narrowed.Errors, msg)
+		}
+	}
+	for _, msg := range p.Moved {
+		if msg.Project == name {
+			narrowed.Moved = append(narrowed.Moved, msg)
+		}
+	}
+	return narrowed
+}
+
+// environments lists the environments the plan changes, in the order they
+// are applied.
+func (p *SyncPlan) environments() []string {
+	var envIDs []string
+	for _, change := range p.Changes {
+		if !slices.Contains(envIDs, change.Environment) {
+			envIDs = append(envIDs, change.Environment)
+		}
+	}
+	return envIDs
+}
+
+// countActions tallies changes per action.
+func (p *SyncPlan) countActions() map[string]int {
+	counts := make(map[string]int)
+	for _, change := range p.Changes {
+		counts[change.Action]++
+	}
+	return counts
+}
+
+// buildSyncPlan decides what to do for every project by comparing disk with
+// the sync state and Arcane. changedProjects (from git) is only consulted for
+// projects the state file doesn't know about yet, e.g. on the first run after
+// upgrading.
+func buildSyncPlan(ctx context.Context, config Config, state *SyncState, inv *projectInventory, changedProjects map[string]string, targetCommit string) *SyncPlan {
+	plan := &SyncPlan{TargetCommit: targetCommit, Changes: []PlannedChange{}}
+
+	envIDs := make([]string, 0, len(inv.Arcane)+len(inv.listErrs))
+	for envID := range inv.Arcane {
+		envIDs = append(envIDs, envID)
+	}
+	for envID := range inv.listErrs {
+		envIDs = append(envIDs, envID)
+	}
+	sort.Strings(envIDs)
+	for _, envID := range envIDs {
+		if err := inv.listErrs[envID]; err != nil {
+			if envID == config.ArcaneEnvID {
+				plan.warn("", fmt.Sprintf("Could not list Arcane projects: %v", err))
+			} else {
+				plan.warn("", fmt.Sprintf("Could not list Arcane projects in environment %s: %v", envID, err))
+			}
+			continue
+		}
+
+		// Warn about duplicates to prevent surprising behavior
+		var names []string
+		for name := range inv.Arcane[envID] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if projects := inv.Arcane[envID][name]; len(projects) > 1 {
+				var ids []string
+				for _, p := range projects {
+					ids = append(ids, p.ID)
+				}
+				plan.warn(name, fmt.Sprintf("Multiple Arcane projects share the same name '%s' (IDs: %s). arcane-gitops will only operate on one; please delete duplicates in Arcane UI.", name, strings.Join(ids, ", ")))
+			}
+		}
+	}
+
+	// Folders deploying as the same project would overwrite each other
+	folders := make(map[string][]string)
+	for _, name := range inv.DiskProjects {
+		if settings, ok := inv.Settings[name]; ok && settings.Enabled {
+			target := describeTarget(config, settings)
+			folders[target] = append(folders[target], name)
+		}
+	}
+
+	// Compare disk to Arcane - disk is source of truth
+	for _, name := range inv.DiskProjects {
+		settings, ok := inv.Settings[name]
+		if !ok {
+			plan.fail(name, fmt.Sprintf("Invalid settings for project %s: %v", name, inv.settingsErrs[name]))
+			continue
+		}
+		if !settings.Enabled {
+			// Neither synced nor pruned while disabled
+			continue
+		}
+		if target := describeTarget(config, settings); len(folders[target]) > 1 {
+			plan.fail(name, fmt.Sprintf("Projects %s all deploy as %s; give each its own name in %s", strings.Join(folders[target], ", "), target, projectSettingsFile))
+			continue
+		}
+
+		entry, tracked := state.Projects[name]
+		if previous := entry.settings(config, name); tracked && (previous.Name != settings.Name || previous.EnvID != settings.EnvID) {
+			plan.warn(name, fmt.Sprintf("Project %s now deploys as %s; the project it was deployed as before (%s) is left in Arcane", name, describeTarget(config, settings), describeTarget(config, previous)))
+		}
+
+		// Unreadable content, such as an env file that fails to decrypt,
+		// fails the project whether or not it exists in Arcane yet
+		content, err := readProjectContent(ctx, config, name)
+		if err != nil {
+			plan.fail(name, fmt.Sprintf("Failed to read project %s: %v", name, err))
+			continue
+		}
+		candidates := inv.arcaneProjects(settings.EnvID, settings.Name)
+
+		if len(candidates) == 0 {
+			reason := "not present in Arcane"
+			if target := describeTarget(config, settings); target != name {
+				reason = fmt.Sprintf("not present in Arcane as %s", target)
+			}
+			if !plan.admit(config, inv.policy, name, content) {
+				continue
+			}
+			plan.add(PlannedChange{Project: name, Action: actionCreate, Reason: reason, content: content, settings: settings})
+			continue
+		}
+
+		project := selectPreferredProject(candidates)
+		change := PlannedChange{Project: name, ProjectID: project.ID, content: content, arcane: project, settings: settings}
+
+		_, changedInGit := changedProjects[name]
+		// State written before project files were tracked has no FilesHash;
+		// fall back to the git diff for those entries
+		filesUnknown := entry.FilesHash == "" && content.FilesHash != ""
+
+		switch {
+		case !tracked:
+			// Deployed before state tracking existed. Adopting records it as
+			// synced, so only adopt what Arcane already has from the repo.
+			switch drifted := detectDrift(content, project); {
+			case changedInGit:
+				change.Action, change.Reason = actionUpdate, "changed in git since the last run"
+			case project.ComposeContent == "":
+				change.Action, change.Reason = actionUpdate, "not yet tracked in sync state, and Arcane doesn't report its content"
+			case len(drifted) > 0:
+				change.Action, change.Reason = actionUpdate, fmt.Sprintf("not yet tracked in sync state, and %s differs in Arcane", strings.Join(drifted, " and "))
+			default:
+				change.Action, change.Reason = actionAdopt, "already deployed, not yet tracked in sync state"
+			}
+		case entry.pinned(content):
+			// Deploying this content failed before; wait for a fix
+			plan.warn(name, fmt.Sprintf("Project %s is pinned to %s after rolling back %s (%s); push a fix or run 'deploy --force %s'",
+				name, shortCommit(entry.Commit), shortCommit(entry.RolledBack.FailedCommit), entry.RolledBack.Reason, name))
+		case entry.ContentHash != content.Hash():
+			// Content differs from what was last successfully applied
+			change.Action, change.Reason = actionUpdate, "compose or .env differs from the last applied version"
+		case filesUnknown && changedInGit, !filesUnknown && entry.FilesHash != content.FilesHash:
+			change.Action, change.Reason = actionRedeploy, "project files changed"
+		default:
+			// Git hasn't changed this project, but it may have been edited in Arcane
+			if reason := planDrift(config.DriftPolicy, name, content, project, plan); reason != "" {
+				change.Action, change.Reason = actionUpdate, reason
+			} else if filesUnknown {
+				change.Action, change.Reason = actionAdopt, "recording project files in sync state"
+			}
+		}
+
+		switch change.Action {
+		case actionUpdate, actionRedeploy:
+			// Refused content is never pushed or redeployed; Arcane keeps the
+			// last good version
+			if !plan.admit(config, inv.policy, name, content) {
+				continue
+			}
+		default:
+			// Nothing is pushed, but what is deployed may break rules added since
+			plan.audit(config, inv.policy, name, content)
+		}
+		if change.Action != "" {
+			plan.add(change)
+		}
+	}
+
+	planPrune(config, state, inv, plan)
+
+	// Environments are applied one after another. Within each, lower order
+	// goes first and prunes last; the sort is stable, so ties stay in name order.
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		a, b := plan.Changes[i], plan.Changes[j]
+		if a.Environment != b.Environment {
+			return a.Environment < b.Environment
+		}
+		if (a.Action == actionPrune) != (b.Action == actionPrune) {
+			return b.Action == actionPrune
+		}
+		return a.Action != actionPrune && a.settings.Order < b.settings.Order
+	})
+
+	return plan
+}
+
+// describeTarget names the Arcane project a folder deploys as, with its
+// environment when that isn't the default one.
+func describeTarget(config Config, settings ProjectSettings) string {
+	if settings.EnvID == config.ArcaneEnvID {
+		return settings.Name
+	}
+	return fmt.Sprintf("%s in environment %s", settings.Name, settings.EnvID)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+const testCompose = "services:\n  web:\n    image: nginx:1.29\n    restart: always\n"
+
+// testRepo commits files to a new git repository and returns a configuration
+// syncing it to environment 0.
+func testRepo(t *testing.T, files map[string]string) Config {
+	t.Helper()
+	dir := t.TempDir()
+	testGit(t, dir, "init", "-q")
+	commitFiles(t, dir, files)
+	return Config{
+		RepoPath:       dir,
+		ArcaneEnvID:    "0",
+		DriftPolicy:    driftPolicyReport,
+		PruneEnabled:   true,
+		PruneMaxPerRun: -1,
+		ProjectTimeout: time.Minute,
+	}
+}
+
+// commitFiles writes files to a repository and commits them.
+func commitFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	writeFiles(t, dir, files)
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "test")
+}
+
+func testGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	if output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// testInventory takes the inventory of the repository as gatherInventory
+// would, with projects as the content of environment 0.
+func testInventory(t *testing.T, config Config, projects ...arcane.Project) *projectInventory {
+	t.Helper()
+	rules, err := loadIgnoreRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskProjects, err := scanDiskProjects(config, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := &projectInventory{
+		DiskProjects: diskProjects,
+		Settings:     make(map[string]ProjectSettings),
+		Arcane:       map[string]map[string][]arcane.Project{config.ArcaneEnvID: {}},
+		settingsErrs: make(map[string]error),
+		ignore:       rules,
+		policy:       &Policy{},
+	}
+	for _, name := range diskProjects {
+		settings, err := loadProjectSettings(config, name)
+		if err != nil {
+			inv.settingsErrs[name] = err
+			continue
+		}
+		inv.Settings[name] = settings
+	}
+	for _, p := range projects {
+		inv.Arcane[config.ArcaneEnvID][p.Name] = append(inv.Arcane[config.ArcaneEnvID][p.Name], p)
+	}
+	return inv
+}
+
+// summarizeChanges lists a plan's changes as "action project id".
+func summarizeChanges(plan *SyncPlan) []string {
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, strings.TrimSpace(change.Action+" "+change.Project+" "+change.ProjectID))
+	}
+	return changes
+}
+
+func TestPlanPruneMovedFolders(t *testing.T) {
+	tests := []struct {
+		name        string
+		projectsDir string
+		files       map[string]string
+		state       map[string]ProjectSyncState
+		arcane      []arcane.Project
+		want        []string // Changes
+		moved       []string
+	}{
+		{
+			name:   "renamed folder keeps its name",
+			files:  map[string]string{"bar/compose.yaml": testCompose, "bar/.arcane-gitops.yaml": "name: foo\n"},
+			state:  map[string]ProjectSyncState{"foo": {Commit: "c1"}},
+			arcane: []arcane.Project{{ID: "p1", Name: "foo", ComposeContent: testCompose}},
+			want:   []string{"adopt bar p1"},
+			moved:  []string{"foo"},
+		},
+		{
+			name:        "PROJECTS_DIR change",
+			projectsDir: "stacks",
+			files:       map[string]string{"stacks/web/compose.yaml": testCompose},
+			state:       map[string]ProjectSyncState{"web": {Commit: "c1", ArcaneName: "web", EnvID: "0"}},
+			arcane:      []arcane.Project{{ID: "p1", Name: "web", ComposeContent: testCompose}},
+			want:        []string{"adopt stacks/web p1"},
+			moved:       []string{"web"},
+		},
+		{
+			name:   "removed folder",
+			files:  map[string]string{"bar/compose.yaml": testCompose},
+			state:  map[string]ProjectSyncState{"foo": {Commit: "c1"}},
+			arcane: []arcane.Project{{ID: "p1", Name: "foo", ComposeContent: testCompose}, {ID: "p2", Name: "bar", ComposeContent: testCompose}},
+			want:   []string{"adopt bar p2", "prune foo p1"},
+		},
+		{
+			name:   "same name in another environment",
+			files:  map[string]string{"bar/compose.yaml": testCompose, "bar/.arcane-gitops.yaml": "name: foo\n"},
+			state:  map[string]ProjectSyncState{"foo": {Commit: "c1"}, "old": {Commit: "c1", ArcaneName: "foo", EnvID: "2"}},
+			arcane: []arcane.Project{{ID: "p1", Name: "foo", ComposeContent: testCompose}},
+			want:   []string{"adopt bar p1"},
+			moved:  []string{"foo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testRepo(t, tt.files)
+			config.ProjectsDir = tt.projectsDir
+			state := &SyncState{Version: stateFileVersion, Projects: tt.state}
+			plan := buildSyncPlan(context.Background(), config, state, testInventory(t, config, tt.arcane...), nil, "c2")
+
+			if len(plan.Errors) > 0 {
+				t.Fatalf("errors: %v", plan.Errors)
+			}
+			if got := summarizeChanges(plan); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+			var moved []string
+			for _, msg := range plan.Moved {
+				moved = append(moved, msg.Project)
+			}
+			if strings.Join(moved, ", ") != strings.Join(tt.moved, ", ") {
+				t.Errorf("moved = %q, want %q", moved, tt.moved)
+			}
+		})
+	}
+}
+
+func TestBuildSyncPlanFailsUnreadableProjects(t *testing.T) {
+	config := testRepo(t, map[string]string{
+		"web/compose.yaml": "include:\n  - missing.yaml\n" + testCompose,
+		"db/compose.yaml":  "include:\n  - missing.yaml\n" + testCompose,
+	})
+	// Whether or not the project exists in Arcane, it fails the run
+	inv := testInventory(t, config, arcane.Project{ID: "p1", Name: "web", ComposeContent: testCompose})
+	plan := buildSyncPlan(context.Background(), config, &SyncState{Projects: map[string]ProjectSyncState{}}, inv, nil, "c1")
+
+	if len(plan.Changes) > 0 {
+		t.Errorf("changes = %q, want none", summarizeChanges(plan))
+	}
+	var failed []string
+	for _, msg := range plan.Errors {
+		failed = append(failed, msg.Project)
+	}
+	if want := []string{"db", "web"}; strings.Join(failed, ", ") != strings.Join(want, ", ") {
+		t.Errorf("failed projects = %q, want %q (%v)", failed, want, plan.Errors)
+	}
+}
+
+func TestBuildSyncPlanActions(t *testing.T) {
+	config := testRepo(t, map[string]string{
+		"web/compose.yaml": testCompose,
+		"web/.env":         "A=1\n",
+		"web/Dockerfile":   "FROM nginx:1.29\n",
+	})
+	content, err := readProjectContent(context.Background(), config, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced := ProjectSyncState{Commit: "c1", ContentHash: content.Hash(), FilesHash: content.FilesHash}
+	tracked := func(modify func(*ProjectSyncState)) *ProjectSyncState {
+		entry := synced
+		if modify != nil {
+			modify(&entry)
+		}
+		return &entry
+	}
+	deployed := arcane.Project{ID: "p1", Name: "web", ComposeContent: testCompose, EnvContent: "A=1\n"}
+	inArcane := func(modify func(*arcane.Project)) *arcane.Project {
+		project := deployed
+		if modify != nil {
+			modify(&project)
+		}
+		return &project
+	}
+
+	tests := []struct {
+		name    string
+		entry   *ProjectSyncState // nil when not tracked
+		arcane  *arcane.Project   // nil when missing
+		changed bool              // In git since the last run
+		drift   string
+		action  string // "" for none
+		reason  string // Part of the reason, or of a warning without an action
+	}{
+		{name: "missing in Arcane", action: actionCreate, reason: "not present in Arcane"},
+		{name: "missing in Arcane, tracked", entry: tracked(nil), action: actionCreate, reason: "not present in Arcane"},
+
+		{name: "untracked, same content", arcane: inArcane(nil), action: actionAdopt, reason: "already deployed"},
+		{name: "untracked, changed in git", arcane: inArcane(nil), changed: true, action: actionUpdate, reason: "changed in git"},
+		{name: "untracked, content unknown", arcane: inArcane(func(p *arcane.Project) { p.ComposeContent = "" }), action: actionUpdate, reason: "doesn't report its content"},
+		{name: "untracked, env differs", arcane: inArcane(func(p *arcane.Project) { p.EnvContent = "A=2\n" }), action: actionUpdate, reason: "env differs in Arcane"},
+
+		{name: "in sync", entry: tracked(nil), arcane: inArcane(nil)},
+		{name: "in sync, changed in git", entry: tracked(nil), arcane: inArcane(nil), changed: true},
+		{name: "content changed", entry: tracked(func(e *ProjectSyncState) { e.ContentHash = "old" }), arcane: inArcane(nil), action: actionUpdate, reason: "differs from the last applied version"},
+		{name: "project files changed", entry: tracked(func(e *ProjectSyncState) { e.FilesHash = "old" }), arcane: inArcane(nil), action: actionRedeploy, reason: "project files changed"},
+		{name: "files not tracked yet, changed in git", entry: tracked(func(e *ProjectSyncState) { e.FilesHash = "" }), arcane: inArcane(nil), changed: true, action: actionRedeploy, reason: "project files changed"},
+		{name: "files not tracked yet", entry: tracked(func(e *ProjectSyncState) { e.FilesHash = "" }), arcane: inArcane(nil), action: actionAdopt, reason: "recording project files"},
+		{
+			name: "pinned after a rollback",
+			entry: tracked(func(e *ProjectSyncState) {
+				e.ContentHash = "good"
+				e.RolledBack = &RollbackRecord{FailedCommit: "c2", ContentHash: content.Hash(), FilesHash: content.FilesHash, Reason: "unhealthy"}
+			}),
+			arcane: inArcane(nil),
+			reason: "is pinned to c1",
+		},
+
+		{name: "drift reported", entry: tracked(nil), arcane: inArcane(func(p *arcane.Project) { p.ComposeContent += "  db:\n    image: postgres:16\n" }), drift: driftPolicyReport, reason: "compose differs in Arcane"},
+		{name: "drift re-applied", entry: tracked(nil), arcane: inArcane(func(p *arcane.Project) { p.EnvContent = "" }), drift: driftPolicyReapply, action: actionUpdate, reason: "env differs in Arcane"},
+		{name: "drift ignored", entry: tracked(nil), arcane: inArcane(func(p *arcane.Project) { p.EnvContent = "" }), drift: driftPolicyOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := config
+			if tt.drift != "" {
+				config.DriftPolicy = tt.drift
+			}
+			state := &SyncState{Version: stateFileVersion, Projects: map[string]ProjectSyncState{}}
+			if tt.entry != nil {
+				state.Projects["web"] = *tt.entry
+			}
+			var projects []arcane.Project
+			if tt.arcane != nil {
+				projects = append(projects, *tt.arcane)
+			}
+			changed := map[string]string{}
+			if tt.changed {
+				changed["web"] = "web/compose.yaml"
+			}
+
+			plan := buildSyncPlan(context.Background(), config, state, testInventory(t, config, projects...), changed, "c2")
+			if len(plan.Errors) > 0 {
+				t.Fatalf("errors: %v", plan.Errors)
+			}
+			if tt.action == "" {
+				if len(plan.Changes) > 0 {
+					t.Fatalf("changes = %q, want none", summarizeChanges(plan))
+				}
+				if tt.reason == "" && len(plan.Warnings) > 0 {
+					t.Errorf("warnings = %v, want none", plan.Warnings)
+				}
+				if tt.reason != "" && (len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0].Message, tt.reason)) {
+					t.Errorf("warnings = %v, want one about %q", plan.Warnings, tt.reason)
+				}
+				return
+			}
+			if len(plan.Changes) != 1 {
+				t.Fatalf("changes = %q, want one %s", summarizeChanges(plan), tt.action)
+			}
+			change := plan.Changes[0]
+			if change.Action != tt.action || !strings.Contains(change.Reason, tt.reason) {
+				t.Errorf("change = %s (%s), want %s (%s)", change.Action, change.Reason, tt.action, tt.reason)
+			}
+			if tt.arcane != nil && change.ProjectID != tt.arcane.ID {
+				t.Errorf("project ID = %q, want %q", change.ProjectID, tt.arcane.ID)
+			}
+		})
+	}
+}
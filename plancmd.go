@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// runPlanCommand implements "arcane-gitops plan": show what a sync would do
+// without resetting the checkout or calling any mutating Arcane endpoint.
+func runPlanCommand(args []string) int {
+	flags := newFlagSet("plan")
+	jsonOutput := flags.Bool("json", false, "print the plan as JSON")
+	flags.Usage = func() { commandUsage(flags, "plan") }
+	if code, ok := parseNoArgs(flags, args); !ok {
+		return code
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	// Planning is read-only: keep it out of the sync log, and keep stdout
+	// clean for the JSON document.
+	log.SetOutput(io.Discard)
+	if *jsonOutput {
+		consoleOutput = os.Stderr
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if err := setupGitAuth(ctx, config); err != nil {
+		logError(fmt.Sprintf("Git authentication setup failed: %v", err))
+		return exitError
+	}
+	client := newArcaneClient(config)
+
+	plan, err := runPlan(ctx, config, client)
+	if err != nil {
+		logError(fmt.Sprintf("Plan failed: %v", err))
+		return exitError
+	}
+
+	if *jsonOutput {
+		if code := printJSON(plan); code != exitOK {
+			return code
+		}
+	} else {
+		printPlan(os.Stdout, plan)
+	}
+
+	if len(plan.Errors) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// runPlan fetches the remote and builds the plan for the remote branch head.
+// The target commit is evaluated in a temporary worktree, so the real
+// checkout is left exactly as it is.
+func runPlan(ctx context.Context, config Config, client *arcane.Client) (*SyncPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.SyncTimeout)
+	defer cancel()
+
+	if err := os.Chdir(config.RepoPath); err != nil {
+		return nil, fmt.Errorf("failed to change to repository directory: %w", err)
+	}
+
+	logInfo("Fetching from remote...")
+	if err := runGitCommand(ctx, "fetch", "origin"); err != nil {
+		return nil, fmt.Errorf("failed to fetch from remote: %w", err)
+	}
+
+	branch, err := getCurrentBranch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	headCommit, err := getCurrentCommit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current commit: %w", err)
+	}
+	targetCommit, err := resolveCommit(ctx, "origin/"+branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve origin/%s: %w", branch, err)
+	}
+
+	worktree, cleanup, err := checkoutWorktree(ctx, config.RepoPath, targetCommit)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	planConfig := config
+	planConfig.RepoPath = worktree
+
+	state, err := loadSyncState(config.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	inv, err := gatherInventory(ctx, planConfig, client, state)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := buildSyncPlan(ctx, planConfig, state, inv, detectChangedProjects(ctx, headCommit, targetCommit, config, inv.DiskProjects), targetCommit)
+	plan.Branch = branch
+	plan.FromCommit = headCommit
+	describePlanChanges(ctx, plan, state)
+	return plan, nil
+}
+
+// checkoutWorktree checks a commit out into a temporary worktree, for planning
+// or a rollback, and copies in the host-local files a real sync would preserve.
+func checkoutWorktree(ctx context.Context, repoPath, commit string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "arcane-gitops-worktree-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create worktree: %w", err)
+	}
+
+	if err := runGitCommand(ctx, "worktree", "add", "--detach", "--quiet", dir, commit); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("failed to check out %s: %w", shortCommit(commit), err)
+	}
+
+	cleanup := func() {
+		// Also runs after cancellation
+		if err := runGitCommand(context.WithoutCancel(ctx), "worktree", "remove", "--force", dir); err != nil {
+			logWarning(fmt.Sprintf("Failed to remove worktree %s: %v", dir, err))
+		}
+		_ = os.RemoveAll(dir) // Already gone unless removal failed
+	}
+
+	if err := copyPreservedLocalFiles(ctx, repoPath, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// copyPreservedLocalFiles copies untracked files matching preservedLocalFiles
+// (e.g. .env) from the checkout into a worktree.
+func copyPreservedLocalFiles(ctx context.Context, repoPath, worktree string) error {
+	output, err := gitCommand(ctx, "-C", repoPath, "ls-files").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list tracked files: %w", err)
+	}
+	tracked := make(map[string]bool)
+	for _, file := range strings.Split(string(output), "\n") {
+		tracked[file] = true
+	}
+
+	return filepath.WalkDir(repoPath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isPreservedLocalFile(entry.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(repoPath, p)
+		if err != nil || tracked[filepath.ToSlash(rel)] {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		dest := filepath.Join(worktree, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", rel, err)
+		}
+		if err := os.WriteFile(dest, data, 0600); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", rel, err)
+		}
+		return nil
+	})
+}
+
+func isPreservedLocalFile(name string) bool {
+	for _, pattern := range preservedLocalFiles {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// describePlanChanges fills in compose diffs and changed .env keys, comparing
+// against what Arcane reports or, failing that, the last applied commit.
+func describePlanChanges(ctx context.Context, plan *SyncPlan, state *SyncState) {
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.content == nil || (change.Action != actionCreate && change.Action != actionUpdate) {
+			continue
+		}
+
+		oldCompose, oldLabel, known := previousCompose(ctx, change, state)
+		if !known && change.Action != actionCreate {
+			continue
+		}
+		change.ComposeDiff = unifiedDiff(
+			fmt.Sprintf("%s/compose (%s)", change.Project, oldLabel),
+			fmt.Sprintf("%s/compose (%s)", change.Project, shortCommit(plan.TargetCommit)),
+			oldCompose, change.content.Compose)
+
+		// Arcane is the only place the previous .env is known, since .env is
+		// usually untracked
+		if change.arcane.ComposeContent != "" {
+			change.EnvKeys = changedEnvKeys(change.arcane.EnvContent, change.content.Env)
+		}
+	}
+}
+
+func previousCompose(ctx context.Context, change *PlannedChange, state *SyncState) (string, string, bool) {
+	if change.Action == actionCreate {
+		return "", "none", false
+	}
+	if change.arcane.ComposeContent != "" {
+		return change.arcane.ComposeContent, "Arcane", true
+	}
+	// A merged compose file can only be compared with what Arcane has
+	if len(change.content.ComposeFiles) > 1 {
+		return "", "", false
+	}
+	if entry, ok := state.Projects[change.Project]; ok && entry.Commit != "" {
+		for _, name := range composeFileNames {
+			if content, err := readFileAtCommit(ctx, entry.Commit, change.Project+"/"+name); err == nil {
+				return content, shortCommit(entry.Commit), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// changedEnvKeys lists keys that were added, removed or changed. Values are
+// never reported since .env files usually hold secrets.
+func changedEnvKeys(oldEnv, newEnv string) []string {
+	oldValues := parseEnvContent(oldEnv)
+	newValues := parseEnvContent(newEnv)
+
+	var keys []string
+	for key, value := range newValues {
+		if old, ok := oldValues[key]; !ok || old != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range oldValues {
+		if _, ok := newValues[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseEnvContent(content string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		values[strings.TrimSpace(strings.TrimPrefix(key, "export "))] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+var planActionSymbols = map[string]string{
+	actionCreate:   colorGreen + "+" + colorReset,
+	actionUpdate:   colorYellow + "~" + colorReset,
+	actionRedeploy: colorYellow + "*" + colorReset,
+	actionPrune:    colorRed + "-" + colorReset,
+	actionAdopt:    colorBlue + "=" + colorReset,
+}
+
+// printPlan renders the plan in a Terraform-like format.
+func printPlan(w io.Writer, plan *SyncPlan) {
+	fmt.Fprintf(w, "Plan for %s: %s -> %s\n\n", plan.Branch, shortCommit(plan.FromCommit), shortCommit(plan.TargetCommit))
+
+	width := 0
+	for _, change := range plan.Changes {
+		width = max(width, len(change.Project))
+	}
+
+	envIDs := plan.environments()
+	currentEnv := ""
+	for _, change := range plan.Changes {
+		if len(envIDs) > 1 && change.Environment != currentEnv {
+			if currentEnv != "" {
+				fmt.Fprintln(w)
+			}
+			currentEnv = change.Environment
+			fmt.Fprintf(w, "Environment %s:\n", currentEnv)
+		}
+		fmt.Fprintf(w, "  %s %-*s  %-8s  %s\n", planActionSymbols[change.Action], width, change.Project, change.Action, change.Reason)
+		if len(change.EnvKeys) > 0 {
+			fmt.Fprintf(w, "      .env keys changed: %s\n", strings.Join(change.EnvKeys, ", "))
+		}
+		for _, line := range splitLines(change.ComposeDiff) {
+			color := ""
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+				color = colorBlue
+			case strings.HasPrefix(line, "+"):
+				color = colorGreen
+			case strings.HasPrefix(line, "-"):
+				color = colorRed
+			}
+			if color != "" {
+				fmt.Fprintf(w, "      %s%s%s\n", color, line, colorReset)
+			} else {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+		}
+	}
+	if len(plan.Changes) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	for _, msg := range plan.Moved {
+		fmt.Fprintln(w, msg.Message)
+	}
+	if len(plan.Moved) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	for _, msg := range plan.Warnings {
+		fmt.Fprintf(w, "%sWarning:%s %s\n", colorYellow, colorReset, msg.Message)
+	}
+	for _, msg := range plan.Errors {
+		fmt.Fprintf(w, "%sError:%s %s\n", colorRed, colorReset, msg.Message)
+	}
+	if len(plan.Warnings)+len(plan.Errors) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	if len(plan.Changes) == 0 {
+		fmt.Fprintln(w, "No changes. Arcane is in sync with the repository.")
+		return
+	}
+
+	counts := plan.countActions()
+	summary := fmt.Sprintf("Plan: %d to create, %d to update, %d to redeploy, %d to prune",
+		counts[actionCreate], counts[actionUpdate], counts[actionRedeploy], counts[actionPrune])
+	if counts[actionAdopt] > 0 {
+		summary += fmt.Sprintf(", %d to adopt", counts[actionAdopt])
+	}
+	fmt.Fprintln(w, summary+".")
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Policy severities: what a violation of a rule does
+const (
+	policyDeny = "deny" // The project is not synced
+	policyWarn = "warn" // The project is synced and the violation reported
+	policyOff  = "off"  // The rule isn't checked
+)
+
+// policyCheck is a rule a policy file can turn on. Adding a rule is adding
+// an entry to policyChecks.
+type policyCheck struct {
+	check   func(project *composeProject, options map[string][]string) []policyFinding
+	options map[string]policyOption // Options besides severity and allow
+}
+
+type policyOption struct {
+	values   []string // Allowed values; empty allows any
+	defaults []string // Used when the option is left out; empty makes it required
+}
+
+// policyFinding is where a project breaks a rule.
+type policyFinding struct {
+	keys []string // Key path in the compose files, to locate the finding
+	msg  string
+}
+
+var policyChecks = map[string]policyCheck{
+	"no-privileged":  {check: checkNoPrivileged},
+	"no-latest-tag":  {check: checkNoLatestTag},
+	"restart-policy": {check: checkRestartPolicy},
+	"host-network":   {check: checkHostNetwork},
+	"required-labels": {check: checkRequiredLabels, options: map[string]policyOption{
+		"labels": {},
+	}},
+	"resource-limits": {check: checkResourceLimits, options: map[string]policyOption{
+		"limits": {values: []string{"memory", "cpus", "pids"}, defaults: []string{"memory"}},
+	}},
+}
+
+// Policy is the set of rules every compose project pushed to Arcane must
+// follow, read from POLICY_FILE. The zero Policy has no rules.
+type Policy struct {
+	rules []policyRule
+}
+
+type policyRule struct {
+	name     string
+	severity string
+	allow    []string // Project path patterns the rule doesn't apply to
+	options  map[string][]string
+	check    policyCheck
+}
+
+// PolicyViolation is a rule broken by a project, at a line of one of its
+// compose files.
+type PolicyViolation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Message  string `json:"message"`
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("%s:%d: %s [%s]", v.File, v.Line, v.Message, v.Rule)
+}
+
+// loadPolicy reads the policy file. A relative POLICY_FILE is resolved
+// against the repository, so the rules can be kept next to the projects.
+func loadPolicy(config Config) (*Policy, error) {
+	if config.PolicyFile == "" {
+		return &Policy{}, nil
+	}
+	file := config.PolicyFile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(config.RepoPath, file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read POLICY_FILE: %w", err)
+	}
+
+	policy, err := parsePolicy(string(data))
+	if err != nil {
+		var lineErr *yamlError
+		if errors.As(err, &lineErr) {
+			return nil, fmt.Errorf("%s:%d: %s", config.PolicyFile, lineErr.Line, lineErr.Msg)
+		}
+		return nil, fmt.Errorf("%s: %w", config.PolicyFile, err)
+	}
+	return policy, nil
+}
+
+// parsePolicy reads a mapping of rule names to a severity, or to a mapping
+// with the severity and the rule's options.
+func parsePolicy(data string) (*Policy, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if doc.Kind == yamlNull {
+		return policy, nil
+	}
+	if doc.Kind != yamlMapping {
+		return nil, &yamlError{Line: doc.Line, Msg: "expected a mapping of rules"}
+	}
+
+	for _, pair := range doc.Pairs {
+		fail := func(line int, format string, args ...interface{}) error {
+			return &yamlError{Line: line, Msg: pair.Key + ": " + fmt.Sprintf(format, args...)}
+		}
+		check, known := policyChecks[pair.Key]
+		if !known {
+			names := make([]string, 0, len(policyChecks))
+			for name := range policyChecks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fail(pair.Line, "unknown rule, expected one of %s", strings.Join(names, ", "))
+		}
+
+		rule := policyRule{name: pair.Key, options: make(map[string][]string), check: check}
+		var severity *yamlNode
+		switch pair.Value.Kind {
+		case yamlScalar:
+			severity = pair.Value
+		case yamlMapping:
+			for _, option := range pair.Value.Pairs {
+				switch _, isOption := check.options[option.Key]; {
+				case option.Key == "severity":
+					severity = option.Value
+				case option.Key == "allow" || isOption:
+					values, err := policyStrings(option.Value)
+					if err != nil {
+						return nil, fail(option.Line, "%s: %v", option.Key, err)
+					}
+					if option.Key == "allow" {
+						rule.allow = values
+					} else {
+						rule.options[option.Key] = values
+					}
+				default:
+					return nil, fail(option.Line, "unknown option %q", option.Key)
+				}
+			}
+		default:
+			return nil, fail(pair.Line, "expected a severity or a mapping of options, got %s", pair.Value.describe())
+		}
+
+		if severity == nil {
+			return nil, fail(pair.Line, "severity is required")
+		}
+		switch rule.severity = severity.Value; rule.severity {
+		case policyDeny, policyWarn, policyOff:
+		default:
+			return nil, fail(severity.Line, "severity must be %s, %s or %s, got %q", policyDeny, policyWarn, policyOff, severity.Value)
+		}
+
+		for name, option := range check.options {
+			values, set := rule.options[name]
+			if !set {
+				if len(option.defaults) == 0 {
+					return nil, fail(pair.Line, "%s is required", name)
+				}
+				rule.options[name] = option.defaults
+				continue
+			}
+			for _, value := range values {
+				if len(option.values) > 0 && !slices.Contains(option.values, value) {
+					return nil, fail(pair.Line, "%s: expected %s, got %q", name, strings.Join(option.values, ", "), value)
+				}
+			}
+		}
+		if rule.severity != policyOff {
+			policy.rules = append(policy.rules, rule)
+		}
+	}
+	return policy, nil
+}
+
+// policyStrings accepts a string or a list of strings.
+func policyStrings(node *yamlNode) ([]string, error) {
+	items := []*yamlNode{node}
+	if node.Kind == yamlSequence {
+		items = node.Items
+	}
+	var values []string
+	for _, item := range items {
+		if item.Kind != yamlScalar || strings.TrimSpace(item.Value) == "" {
+			return nil, fmt.Errorf("expected a string or a list of strings, got %s", item.describe())
+		}
+		values = append(values, item.Value)
+	}
+	return values, nil
+}
+
+// evaluate checks a compose project against every rule that applies to it.
+func (p *Policy) evaluate(config Config, projectName string, project *composeProject) []*PolicyViolation {
+	var violations []*PolicyViolation
+	for _, rule := range p.rules {
+		if slices.ContainsFunc(rule.allow, func(pattern string) bool {
+			return matchPathPattern(pattern, projectPath(config, projectName))
+		}) {
+			continue
+		}
+		for _, finding := range rule.check.check(project, rule.options) {
+			file, line := project.locate(finding.keys)
+			violations = append(violations, &PolicyViolation{
+				Rule: rule.name, Severity: rule.severity, File: file, Line: line, Message: finding.msg,
+			})
+		}
+	}
+	return violations
+}
+
+// eachService runs a check on every service of a project, in name order.
+func eachService(project *composeProject, check func(name string, attrs *yamlNode) *policyFinding) []policyFinding {
+	services := project.model.get("services")
+	if services == nil {
+		return nil
+	}
+	pairs := slices.Clone(services.Pairs)
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	var findings []policyFinding
+	for _, service := range pairs {
+		if finding := check(service.Key, service.Value); finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings
+}
+
+func checkNoPrivileged(project *composeProject, _ map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		if privileged := attrs.get("privileged"); privileged != nil {
+			if enabled, _ := parseYAMLBool(privileged); enabled {
+				return &policyFinding{[]string{"services", name, "privileged"}, fmt.Sprintf("services.%s: privileged containers are not allowed", name)}
+			}
+		}
+		return nil
+	})
+}
+
+func checkNoLatestTag(project *composeProject, _ map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		image := attrs.get("image")
+		if image == nil || image.Kind != yamlScalar || interpolated(image) {
+			// Built locally, or only known once deployed
+			return nil
+		}
+		keys := []string{"services", name, "image"}
+		switch tag, digest := imageReference(image.Value); {
+		case digest:
+		case tag == "":
+			return &policyFinding{keys, fmt.Sprintf("services.%s.image: %s has no tag, so it pulls latest; pin a version", name, image.Value)}
+		case tag == "latest":
+			return &policyFinding{keys, fmt.Sprintf("services.%s.image: %s uses the latest tag; pin a version", name, image.Value)}
+		}
+		return nil
+	})
+}
+
+// imageReference returns an image's tag, and whether it is pinned by digest.
+func imageReference(image string) (tag string, digest bool) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return "", true
+	}
+	// A colon before the last slash belongs to the registry's port
+	last := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(last, ":"); i >= 0 {
+		return last[i+1:], false
+	}
+	return "", false
+}
+
+func checkRestartPolicy(project *composeProject, _ map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		if attrs.get("restart") == nil && attrs.get("deploy").get("restart_policy") == nil {
+			return &policyFinding{[]string{"services", name}, fmt.Sprintf("services.%s: restart is required", name)}
+		}
+		return nil
+	})
+}
+
+func checkHostNetwork(project *composeProject, _ map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		if mode := attrs.get("network_mode"); mode != nil && mode.Value == "host" {
+			return &policyFinding{[]string{"services", name, "network_mode"}, fmt.Sprintf("services.%s: host networking is not allowed for this project", name)}
+		}
+		return nil
+	})
+}
+
+func checkRequiredLabels(project *composeProject, options map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		labels := attrs.get("labels")
+		var present []string
+		for _, item := range listItems(labels) {
+			key, _, _ := strings.Cut(item.Value, "=")
+			present = append(present, key)
+		}
+		if labels != nil {
+			for _, pair := range labels.Pairs {
+				present = append(present, pair.Key)
+			}
+		}
+
+		var missing []string
+		for _, label := range options["labels"] {
+			if !slices.Contains(present, label) {
+				missing = append(missing, label)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		keys := []string{"services", name}
+		if labels != nil {
+			keys = append(keys, "labels")
+		}
+		return &policyFinding{keys, fmt.Sprintf("services.%s: missing required label(s) %s", name, strings.Join(missing, ", "))}
+	})
+}
+
+// resourceLimitKeys are the service attributes that set a limit, besides
+// deploy.resources.limits.
+var resourceLimitKeys = map[string]string{"memory": "mem_limit", "cpus": "cpus", "pids": "pids_limit"}
+
+func checkResourceLimits(project *composeProject, options map[string][]string) []policyFinding {
+	return eachService(project, func(name string, attrs *yamlNode) *policyFinding {
+		limits := attrs.get("deploy").get("resources").get("limits")
+		var missing []string
+		for _, limit := range options["limits"] {
+			if limits.get(limit) == nil && attrs.get(resourceLimitKeys[limit]) == nil {
+				missing = append(missing, limit)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		return &policyFinding{[]string{"services", name}, fmt.Sprintf("services.%s: no %s limit set (deploy.resources.limits)", name, strings.Join(missing, " or "))}
+	})
+}
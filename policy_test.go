@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testComposeProject parses a single compose file as project name's.
+func testComposeProject(t *testing.T, name, compose string) *composeProject {
+	t.Helper()
+	doc, err := parseYAML(compose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &composeProject{sources: []composeSource{{file: name + "/compose.yaml", doc: doc}}, model: doc}
+}
+
+func TestPolicyRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		compose string
+		want    []string // Violations, as "line: message [rule] severity"
+	}{
+		{
+			name:    "no-privileged",
+			policy:  "no-privileged: deny\n",
+			compose: "services:\n  a:\n    privileged: true\n  b:\n    privileged: false\n",
+			want:    []string{"3: services.a: privileged containers are not allowed [no-privileged] deny"},
+		},
+		{
+			name:   "no-latest-tag",
+			policy: "no-latest-tag: warn\n",
+			compose: `services:
+  untagged:
+    image: nginx
+  latest:
+    image: nginx:latest
+  pinned:
+    image: nginx:1.29
+  digest:
+    image: nginx@sha256:0123
+  registry:
+    image: registry.local:5000/nginx
+  variable:
+    image: nginx:${TAG}
+  built:
+    build: .
+`,
+			want: []string{
+				"5: services.latest.image: nginx:latest uses the latest tag; pin a version [no-latest-tag] warn",
+				"11: services.registry.image: registry.local:5000/nginx has no tag, so it pulls latest; pin a version [no-latest-tag] warn",
+				"3: services.untagged.image: nginx has no tag, so it pulls latest; pin a version [no-latest-tag] warn",
+			},
+		},
+		{
+			name:    "restart-policy",
+			policy:  "restart-policy: deny\n",
+			compose: "services:\n  a:\n    restart: always\n  b:\n    deploy:\n      restart_policy:\n        condition: on-failure\n  c:\n    image: x\n",
+			want:    []string{"8: services.c: restart is required [restart-policy] deny"},
+		},
+		{
+			name:    "host-network",
+			policy:  "host-network: deny\n",
+			compose: "services:\n  a:\n    network_mode: host\n  b:\n    network_mode: bridge\n",
+			want:    []string{"3: services.a: host networking is not allowed for this project [host-network] deny"},
+		},
+		{
+			name:    "required-labels",
+			policy:  "required-labels:\n  severity: warn\n  labels: [owner, tier]\n",
+			compose: "services:\n  a:\n    labels:\n      owner: me\n      tier: web\n  b:\n    labels:\n      - owner=me\n  c:\n    image: x\n",
+			want: []string{
+				"7: services.b: missing required label(s) tier [required-labels] warn",
+				"9: services.c: missing required label(s) owner, tier [required-labels] warn",
+			},
+		},
+		{
+			name:    "resource-limits",
+			policy:  "resource-limits:\n  severity: deny\n  limits: [memory, pids]\n",
+			compose: "services:\n  a:\n    mem_limit: 1g\n    pids_limit: 100\n  b:\n    deploy:\n      resources:\n        limits:\n          memory: 1g\n  c:\n    image: x\n",
+			want: []string{
+				"5: services.b: no pids limit set (deploy.resources.limits) [resource-limits] deny",
+				"10: services.c: no memory or pids limit set (deploy.resources.limits) [resource-limits] deny",
+			},
+		},
+		{
+			name:    "resource-limits defaults to memory",
+			policy:  "resource-limits: warn\n",
+			compose: "services:\n  a:\n    cpus: 1\n",
+			want:    []string{"2: services.a: no memory limit set (deploy.resources.limits) [resource-limits] warn"},
+		},
+		{
+			name:    "off",
+			policy:  "no-privileged: off\n",
+			compose: "services:\n  a:\n    privileged: true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := parsePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("parsePolicy: %v", err)
+			}
+			name := "apps/web"
+			var got []string
+			for _, v := range policy.evaluate(Config{}, name, testComposeProject(t, name, tt.compose)) {
+				if v.File != name+"/compose.yaml" {
+					t.Errorf("violation in %s, want %s/compose.yaml", v.File, name)
+				}
+				got = append(got, fmt.Sprintf("%d: %s [%s] %s", v.Line, v.Message, v.Rule, v.Severity))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPolicyAllowList(t *testing.T) {
+	policy, err := parsePolicy("host-network:\n  severity: deny\n  allow: [infra/*, monitoring]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compose := "services:\n  a:\n    network_mode: host\n"
+	tests := []struct {
+		config  Config
+		project string
+		allowed bool
+	}{
+		{Config{}, "infra/vpn", true},
+		{Config{}, "infra/vpn/sub", true},
+		{Config{}, "monitoring", true},
+		{Config{}, "apps/monitoring", true}, // A pattern without a slash matches any folder name
+		{Config{}, "apps/web", false},
+		{Config{}, "infrastructure", false},
+		// Patterns are relative to PROJECTS_DIR
+		{Config{ProjectsDir: "stacks"}, "stacks/infra/vpn", true},
+		{Config{ProjectsDir: "stacks"}, "stacks/apps/web", false},
+	}
+	for _, tt := range tests {
+		violations := policy.evaluate(tt.config, tt.project, testComposeProject(t, tt.project, compose))
+		if allowed := len(violations) == 0; allowed != tt.allowed {
+			t.Errorf("%s (PROJECTS_DIR %q): allowed = %v, want %v", tt.project, tt.config.ProjectsDir, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"- no-privileged\n", "line 1: expected a mapping of rules"},
+		{"no-root: deny\n", "line 1: no-root: unknown rule, expected one of host-network, no-latest-tag, no-privileged, required-labels, resource-limits, restart-policy"},
+		{"no-privileged: block\n", `line 1: no-privileged: severity must be deny, warn or off, got "block"`},
+		{"no-privileged:\n  allow: [a]\n", "line 1: no-privileged: severity is required"},
+		{"no-privileged:\n  severity: deny\n  labels: [a]\n", `line 3: no-privileged: unknown option "labels"`},
+		{"required-labels: deny\n", "line 1: required-labels: labels is required"},
+		{"resource-limits:\n  severity: deny\n  limits: [disk]\n", `line 1: resource-limits: limits: expected memory, cpus, pids, got "disk"`},
+		{"no-privileged:\n  severity: deny\n  allow: {a: b}\n", "line 3: no-privileged: allow: expected a string or a list of strings, got a mapping"},
+	}
+	for _, tt := range tests {
+		_, err := parsePolicy(tt.policy)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parsePolicy(%q) = %v, want %s", tt.policy, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// projectSettingsFile optionally configures a project, next to its compose
+// file. It isn't uploaded and changing it doesn't redeploy the project.
+const projectSettingsFile = ".arcane-gitops.yaml"
+
+// Pull policies: how an updated project's containers are recreated
+const (
+	pullPolicyRedeploy = "redeploy" // Arcane's redeploy, which pulls images first
+	pullPolicyAlways   = "always"   // Deploy, pulling images first
+	pullPolicyMissing  = "missing"  // Deploy, pulling only images that aren't present
+)
+
+// projectSettingKeys are the keys a settings file may contain.
+var projectSettingKeys = []string{"name", "environment", "auto_start", "pull_policy", "order", "health_timeout", "enabled", "compose_files"}
+
+// ProjectSettings are the per-project options from projectSettingsFile, with
+// the global configuration filled in for anything it leaves out.
+type ProjectSettings struct {
+	Name          string        // Arcane project name; defaults to the folder path, joined with dashes
+	EnvID         string        // Arcane environment ID; defaults to ARCANE_ENV_MAP, then ARCANE_ENV_ID
+	AutoStart     bool          // Start the project after creating it
+	PullPolicy    string        // One of the pull policies above
+	Order         int           // Projects are applied in ascending order, then by name
+	HealthTimeout time.Duration // Overrides HEALTH_TIMEOUT
+	Enabled       bool          // false leaves the folder alone without pruning its project
+	ComposeFiles  []string      // Compose files to merge, relative to the folder; empty for the defaults
+}
+
+// defaultProjectSettings are the settings of a project without a settings
+// file.
+func defaultProjectSettings(config Config, projectName string) ProjectSettings {
+	return ProjectSettings{
+		Name:          defaultArcaneName(config, projectName),
+		EnvID:         environmentFor(config, projectName),
+		AutoStart:     true,
+		PullPolicy:    pullPolicyRedeploy,
+		HealthTimeout: config.HealthTimeout,
+		Enabled:       true,
+	}
+}
+
+// loadProjectSettings reads a project's settings file, if it has one.
+func loadProjectSettings(config Config, projectName string) (ProjectSettings, error) {
+	settings := defaultProjectSettings(config, projectName)
+
+	data, err := os.ReadFile(filepath.Join(config.RepoPath, projectName, projectSettingsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("failed to read %s: %w", projectSettingsFile, err)
+	}
+
+	if err := parseProjectSettings(string(data), &settings); err != nil {
+		var lineErr *yamlError
+		if errors.As(err, &lineErr) {
+			return settings, fmt.Errorf("%s:%d: %s", projectSettingsFile, lineErr.Line, lineErr.Msg)
+		}
+		return settings, fmt.Errorf("%s: %w", projectSettingsFile, err)
+	}
+	for _, file := range settings.ComposeFiles {
+		if target := path.Join(filepath.ToSlash(projectName), file); target == ".." || strings.HasPrefix(target, "../") {
+			return settings, fmt.Errorf("%s: compose_files: %s is outside the repository", projectSettingsFile, file)
+		}
+	}
+	if settings.HealthTimeout >= config.ProjectTimeout {
+		return settings, fmt.Errorf("%s: health_timeout must be below PROJECT_TIMEOUT (%s)", projectSettingsFile, config.ProjectTimeout)
+	}
+	return settings, nil
+}
+
+// parseProjectSettings applies the settings in data over settings. Unknown
+// keys are errors, so a typo doesn't go unnoticed.
+func parseProjectSettings(data string, settings *ProjectSettings) error {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	if doc.Kind == yamlNull {
+		return nil
+	}
+	if doc.Kind != yamlMapping {
+		return &yamlError{Line: doc.Line, Msg: "expected a mapping of settings"}
+	}
+
+	for _, pair := range doc.Pairs {
+		value := pair.Value
+		if value.Kind == yamlNull {
+			// Same as leaving the key out
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return &yamlError{Line: pair.Line, Msg: pair.Key + ": " + fmt.Sprintf(format, args...)}
+		}
+		if !slices.Contains(projectSettingKeys, pair.Key) {
+			return fail("unknown setting")
+		}
+		if value.Tag != "" {
+			return fail("tags are not supported")
+		}
+		if pair.Key == "compose_files" {
+			if settings.ComposeFiles, err = parseComposeFilesSetting(value); err != nil {
+				return fail("%v", err)
+			}
+			continue
+		}
+		if value.Kind != yamlScalar {
+			return fail("expected a single value, got %s", value.describe())
+		}
+
+		switch pair.Key {
+		case "name":
+			if strings.TrimSpace(value.Value) == "" {
+				return fail("must not be empty")
+			}
+			settings.Name = value.Value
+		case "environment":
+			if strings.TrimSpace(value.Value) == "" {
+				return fail("must not be empty")
+			}
+			settings.EnvID = value.Value
+		case "auto_start":
+			if settings.AutoStart, err = parseYAMLBool(value); err != nil {
+				return fail("%v", err)
+			}
+		case "pull_policy":
+			switch value.Value {
+			case pullPolicyRedeploy, pullPolicyAlways, pullPolicyMissing:
+				settings.PullPolicy = value.Value
+			default:
+				return fail("expected %s, %s or %s, got %q", pullPolicyRedeploy, pullPolicyAlways, pullPolicyMissing, value.Value)
+			}
+		case "order":
+			if settings.Order, err = strconv.Atoi(value.Value); err != nil {
+				return fail("expected a whole number, got %q", value.Value)
+			}
+		case "health_timeout":
+			timeout, err := time.ParseDuration(value.Value)
+			if err != nil || timeout < 0 {
+				return fail("expected a duration such as 90s or 5m (0 disables the check), got %q", value.Value)
+			}
+			settings.HealthTimeout = timeout
+		case "enabled":
+			if settings.Enabled, err = parseYAMLBool(value); err != nil {
+				return fail("%v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseComposeFilesSetting accepts a file or a list of files.
+func parseComposeFilesSetting(node *yamlNode) ([]string, error) {
+	items := []*yamlNode{node}
+	if node.Kind == yamlSequence {
+		items = node.Items
+	}
+	if len(items) == 0 {
+		return nil, errors.New("expected at least one file")
+	}
+
+	var files []string
+	for _, item := range items {
+		if item.Kind != yamlScalar || strings.TrimSpace(item.Value) == "" {
+			return nil, fmt.Errorf("expected a file or a list of files, got %s", item.describe())
+		}
+		file := path.Clean(filepath.ToSlash(item.Value))
+		if path.IsAbs(file) {
+			return nil, fmt.Errorf("%s must be relative to the project folder", item.Value)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func parseYAMLBool(node *yamlNode) (bool, error) {
+	if !node.Quoted {
+		switch node.Value {
+		case "true", "True", "TRUE":
+			return true, nil
+		case "false", "False", "FALSE":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected true or false, got %q", node.Value)
+}
+
+// forProject returns the configuration to apply a project with: its
+// environment and health timeout replace the global ones.
+func (s ProjectSettings) forProject(config Config) Config {
+	config.ArcaneEnvID = s.EnvID
+	config.HealthTimeout = s.HealthTimeout
+	return config
+}
+
+// environmentFor returns the environment ARCANE_ENV_MAP assigns a project
+// folder to, matching its path below PROJECTS_DIR. The first matching pattern wins; without one it is ARCANE_ENV_ID.
+func environmentFor(config Config, projectName string) string {
+	for _, mapping := range config.ArcaneEnvMap {
+		pattern, envID, err := parseEnvMapping(mapping)
+		if err == nil && matchPathPattern(pattern, projectPath(config, projectName)) {
+			return envID
+		}
+	}
+	return config.ArcaneEnvID
+}
+
+// parseEnvMapping splits an ARCANE_ENV_MAP entry, "pattern=id".
+func parseEnvMapping(mapping string) (pattern, envID string, err error) {
+	pattern, envID, found := strings.Cut(mapping, "=")
+	pattern, envID = strings.TrimSpace(pattern), strings.TrimSpace(envID)
+	if !found || pattern == "" || envID == "" {
+		return "", "", fmt.Errorf("expected pattern=id, got %q", mapping)
+	}
+	if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+		return "", "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return pattern, envID, nil
+}
+
+func validateEnvMap(config Config) error {
+	for _, mapping := range config.ArcaneEnvMap {
+		if _, _, err := parseEnvMapping(mapping); err != nil {
+			return fmt.Errorf("ARCANE_ENV_MAP: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// statusPollInterval is how often a project is polled while waiting for it to
+// reach a status.
+const statusPollInterval = 2 * time.Second
+
+type projectListing struct {
+	Name     string `json:"name"`
+	InRepo   bool   `json:"inRepo"`
+	ArcaneID string `json:"arcaneId,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+type projectDetails struct {
+	Name         string     `json:"name"`
+	ArcaneID     string     `json:"arcaneId"`
+	Status       string     `json:"status"`
+	StatusReason string     `json:"statusReason,omitempty"`
+	Path         string     `json:"path,omitempty"`
+	CreatedAt    string     `json:"createdAt,omitempty"`
+	UpdatedAt    string     `json:"updatedAt,omitempty"`
+	InRepo       bool       `json:"inRepo"`
+	Folder       string     `json:"folder,omitempty"`
+	SyncedCommit string     `json:"syncedCommit,omitempty"`
+	SyncedAt     *time.Time `json:"syncedAt,omitempty"`
+}
+
+// runProjectsCommand implements "arcane-gitops projects": list every project,
+// or inspect or operate on a single one in Arcane.
+func runProjectsCommand(args []string) int {
+	fs := newFlagSet("projects")
+	jsonOutput := fs.Bool("json", false, "list, show: print JSON")
+	volumes := fs.Bool("volumes", false, "remove: also delete the project's volumes")
+	noWait := fs.Bool("no-wait", false, "start, stop, restart: don't wait for the project to reach its new status")
+	fs.Usage = func() {
+		commandUsage(fs, "projects")
+		fmt.Fprintln(fs.Output(), `
+Actions:
+  list               List projects on disk and in Arcane (default)
+  show <project>     Show a project's Arcane status and sync state
+  start <project>    Bring a project's containers up
+  stop <project>     Take a project's containers down (volumes are kept)
+  restart <project>  Restart a project's containers
+  pull <project>     Pull a project's images
+  remove <project>   Delete a project from Arcane`)
+	}
+	positional, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	action := "list"
+	if len(positional) > 0 {
+		action = positional[0]
+	}
+	wantArgs := 2
+	switch action {
+	case "list":
+		wantArgs = 1
+	case "show", "start", "stop", "restart", "pull", "remove":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown projects action %q\n\n", action)
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) > wantArgs || (wantArgs == 2 && len(positional) < 2) {
+		if wantArgs == 1 {
+			fmt.Fprintln(os.Stderr, "projects list takes no project name")
+		} else {
+			fmt.Fprintf(os.Stderr, "projects %s takes exactly one project name\n", action)
+		}
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return exitUsage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if action == "list" {
+		// Read-only: stay out of the sync log
+		log.SetOutput(io.Discard)
+		consoleOutput = os.Stderr
+		return listProjects(config, *jsonOutput)
+	}
+
+	ref := resolveProjectRef(config, positional[1])
+	config.ArcaneEnvID = ref.EnvID
+	if action == "show" {
+		log.SetOutput(io.Discard)
+		consoleOutput = os.Stderr
+		return showProject(config, ref, *jsonOutput)
+	}
+
+	setupLogging(config.LogFile)
+	ctx, stop := signalContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, config.ProjectTimeout)
+	defer cancel()
+
+	if err := runProjectAction(ctx, config, action, ref, *volumes, !*noWait); err != nil {
+		logError(fmt.Sprintf("Failed to %s project %s: %v", action, positional[1], err))
+		return exitError
+	}
+	return exitOK
+}
+
+func listProjects(config Config, jsonOutput bool) int {
+	diskProjects, err := listDiskProjects(config)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to list disk projects: %v", err))
+		return exitError
+	}
+	// The names the repository's projects deploy as in this environment
+	var repoNames []string
+	for _, folder := range diskProjects {
+		if settings, err := loadProjectSettings(config, folder); err != nil {
+			logWarning(fmt.Sprintf("Skipping project %s: %v", folder, err))
+		} else if settings.Enabled && settings.EnvID == config.ArcaneEnvID {
+			repoNames = append(repoNames, settings.Name)
+		}
+	}
+	client := newArcaneClient(config)
+	arcaneProjects, err := client.ListProjects(context.Background(), config.ArcaneEnvID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to list Arcane projects: %v", err))
+		return exitError
+	}
+
+	// One row per Arcane project, so duplicates stay visible
+	listings := []projectListing{}
+	listed := make(map[string]bool)
+	for _, p := range arcaneProjects {
+		listings = append(listings, projectListing{
+			Name:     p.Name,
+			InRepo:   slices.Contains(repoNames, p.Name),
+			ArcaneID: p.ID,
+			Status:   p.Status,
+		})
+		listed[p.Name] = true
+	}
+	for _, name := range repoNames {
+		if !listed[name] {
+			listings = append(listings, projectListing{Name: name, InRepo: true})
+		}
+	}
+	sort.SliceStable(listings, func(i, j int) bool {
+		return listings[i].Name < listings[j].Name
+	})
+
+	if jsonOutput {
+		return printJSON(listings)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREPO\tARCANE ID\tSTATUS")
+	for _, p := range listings {
+		inRepo := "no"
+		if p.InRepo {
+			inRepo = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, inRepo, orDash(p.ArcaneID), orDash(p.Status))
+	}
+	_ = w.Flush()
+	return exitOK
+}
+
+func showProject(config Config, ref projectRef, jsonOutput bool) int {
+	ctx := context.Background()
+	client := newArcaneClient(config)
+	found, err := findArcaneProject(ctx, config, client, ref.Name)
+	if err != nil {
+		logError(err.Error())
+		return exitError
+	}
+	// The list omits some fields; fetch the full project
+	project, err := client.GetProject(ctx, config.ArcaneEnvID, found.ID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to get project %s: %v", ref.Name, err))
+		return exitError
+	}
+
+	details := projectDetails{
+		Name:         project.Name,
+		ArcaneID:     project.ID,
+		Status:       project.Status,
+		StatusReason: project.StatusReason,
+		Path:         project.Path,
+		CreatedAt:    project.CreatedAt,
+		UpdatedAt:    project.UpdatedAt,
+		Folder:       ref.Folder,
+		InRepo:       ref.Folder != "",
+	}
+	if state, err := loadSyncState(config.StateFile); err == nil && ref.Folder != "" {
+		if entry, ok := state.Projects[ref.Folder]; ok {
+			syncedAt := entry.SyncedAt
+			details.SyncedCommit, details.SyncedAt = entry.Commit, &syncedAt
+		}
+	}
+
+	if jsonOutput {
+		return printJSON(details)
+	}
+
+	status := orDash(details.Status)
+	if details.StatusReason != "" {
+		status += " (" + details.StatusReason + ")"
+	}
+	syncedAt := "-"
+	if details.SyncedAt != nil {
+		syncedAt = details.SyncedAt.Local().Format("2006-01-02 15:04:05")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", details.Name)
+	fmt.Fprintf(w, "Arcane ID:\t%s\n", details.ArcaneID)
+	fmt.Fprintf(w, "Status:\t%s\n", status)
+	fmt.Fprintf(w, "Path:\t%s\n", orDash(details.Path))
+	fmt.Fprintf(w, "Created:\t%s\n", orDash(details.CreatedAt))
+	fmt.Fprintf(w, "Updated:\t%s\n", orDash(details.UpdatedAt))
+	fmt.Fprintf(w, "In repository:\t%t\n", details.InRepo)
+	if details.Folder != "" && details.Folder != details.Name {
+		fmt.Fprintf(w, "Folder:\t%s\n", details.Folder)
+	}
+	fmt.Fprintf(w, "Synced commit:\t%s\n", orDash(shortCommit(details.SyncedCommit)))
+	fmt.Fprintf(w, "Synced at:\t%s\n", syncedAt)
+	_ = w.Flush()
+	return exitOK
+}
+
+// runProjectAction stops, starts, restarts, pulls or removes a project in
+// Arcane. Status changes are waited for unless wait is false.
+func runProjectAction(ctx context.Context, config Config, action string, ref projectRef, volumes, wait bool) error {
+	client := newArcaneClient(config)
+	project, err := findArcaneProject(ctx, config, client, ref.Name)
+	if err != nil {
+		return err
+	}
+	name := project.Name
+
+	var target string // Status to wait for
+	switch action {
+	case "start":
+		logInfo(fmt.Sprintf("Starting project: %s", name))
+		err = client.StartProject(ctx, config.ArcaneEnvID, project.ID)
+		target = arcane.StatusRunning
+	case "stop":
+		logInfo(fmt.Sprintf("Stopping project: %s", name))
+		err = client.DownProject(ctx, config.ArcaneEnvID, project.ID)
+		target = arcane.StatusStopped
+	case "restart":
+		logInfo(fmt.Sprintf("Restarting project: %s", name))
+		err = client.RestartProject(ctx, config.ArcaneEnvID, project.ID)
+		target = arcane.StatusRunning
+	case "pull":
+		logInfo(fmt.Sprintf("Pulling images for project: %s", name))
+		err = client.PullImages(ctx, config.ArcaneEnvID, project.ID)
+	case "remove":
+		return removeProject(ctx, config, client, project, ref.Folder, volumes)
+	}
+	if err != nil {
+		return err
+	}
+
+	if target != "" && wait {
+		logInfo(fmt.Sprintf("Waiting for project %s to be %s", name, target))
+		if _, err := client.WaitForStatus(ctx, config.ArcaneEnvID, project.ID, statusPollInterval, target); err != nil {
+			return err
+		}
+	}
+	done := map[string]string{"start": "Started", "stop": "Stopped", "restart": "Restarted", "pull": "Pulled images for"}[action]
+	logSuccess(fmt.Sprintf("%s project: %s", done, name))
+	return nil
+}
+
+// removeProject deletes a project from Arcane and the sync state. A project
+// still in the repository (folder) is created again by the next sync.
+func removeProject(ctx context.Context, config Config, client *arcane.Client, project *arcane.Project, folder string, volumes bool) error {
+	logInfo(fmt.Sprintf("Removing project: %s (ID: %s, volumes: %t)", project.Name, project.ID, volumes))
+	// Stopped first, as prune does; a 404 means it is already gone
+	logInfo(fmt.Sprintf("Stopping project: %s", project.Name))
+	if err := client.DownProject(ctx, config.ArcaneEnvID, project.ID); err != nil && !arcane.IsNotFound(err) {
+		return fmt.Errorf("stop (ID: %s): %w", project.ID, err)
+	}
+	if err := client.DeleteProject(ctx, config.ArcaneEnvID, project.ID, arcane.DeleteOptions{RemoveFiles: true, RemoveVolumes: volumes}); err != nil && !arcane.IsNotFound(err) {
+		return fmt.Errorf("delete (ID: %s): %w", project.ID, err)
+	}
+
+	state, err := loadSyncState(config.StateFile)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not update the sync state: %v", err))
+	} else if key, tracked := state.find(config, project.Name, config.ArcaneEnvID); tracked {
+		state.forget(config.StateFile, key)
+	}
+	logSuccess(fmt.Sprintf("Removed project: %s", project.Name))
+
+	if folder != "" {
+		logWarning(fmt.Sprintf("Project %s is still in the repository (%s); the next sync will create it again", project.Name, folder))
+	}
+	return nil
+}
+
+// projectRef is a project named on the command line: the Arcane project, and
+// the folder it is deployed from if the repository has one.
+type projectRef struct {
+	Folder string
+	Name   string
+	EnvID  string
+}
+
+// resolveProjectRef looks a name up as a project folder first, then as the
+// Arcane name of a folder's project. Other names are taken as Arcane projects
+// in ARCANE_ENV_ID.
+func resolveProjectRef(config Config, name string) projectRef {
+	ref := projectRef{Name: name, EnvID: config.ArcaneEnvID}
+	diskProjects, err := listDiskProjects(config)
+	if err != nil {
+		return ref
+	}
+	for _, folder := range diskProjects {
+		settings, err := loadProjectSettings(config, folder)
+		if err != nil {
+			continue
+		}
+		if folder == name {
+			return projectRef{Folder: folder, Name: settings.Name, EnvID: settings.EnvID}
+		}
+		if settings.Name == name && settings.EnvID == config.ArcaneEnvID {
+			ref.Folder = folder
+		}
+	}
+	return ref
+}
+
+// findArcaneProject looks a project up by name. Like a sync, it picks the
+// preferred one when Arcane has duplicates.
+func findArcaneProject(ctx context.Context, config Config, client *arcane.Client, name string) (*arcane.Project, error) {
+	candidates, err := client.FindProjectsByName(ctx, config.ArcaneEnvID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up project %s: %w", name, err)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("project %s not found in Arcane", name)
+	}
+	project := selectPreferredProject(candidates)
+	if len(candidates) > 1 {
+		logWarning(fmt.Sprintf("Multiple Arcane projects are named %s; using ID %s", name, project.ID))
+	}
+	return &project, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// planPrune finds Arcane projects that were previously deployed by
+// arcane-gitops but whose folders no longer exist on disk. Only projects
+// recorded in the sync state are considered, so projects created by hand in
+// Arcane are never touched. Neither are ignored folders: ignoring one stops
+// syncing it, it doesn't remove it.
+//
+// A folder that was renamed (keeping its project with name:) or moved by a
+// PROJECTS_DIR change still deploys as the same project from its new path.
+// Its old entry is dropped from the state instead of pruning the project.
+func planPrune(config Config, state *SyncState, inv *projectInventory, plan *SyncPlan) {
+	onDisk := make(map[string]bool, len(inv.DiskProjects))
+	deployedFrom := make(map[string]string)
+	for _, name := range inv.DiskProjects {
+		onDisk[name] = true
+		if settings, ok := inv.Settings[name]; ok {
+			deployedFrom[describeTarget(config, settings)] = name
+		}
+	}
+
+	var candidates []string
+	for name, entry := range state.Projects {
+		if onDisk[name] || inv.ignore.excludes(name) {
+			continue
+		}
+		target := entry.settings(config, name)
+		if folder, ok := deployedFrom[describeTarget(config, target)]; ok {
+			plan.Moved = append(plan.Moved, PlanMessage{Project: name, Message: fmt.Sprintf("Project %s is deployed from %s now; dropping %s from the sync state", describeTarget(config, target), folder, name)})
+			continue
+		}
+		// Without a project list every tracked project would look already deleted
+		if inv.listed(target.EnvID) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Slice(plan.Moved, func(i, j int) bool { return plan.Moved[i].Project < plan.Moved[j].Project })
+	if len(candidates) == 0 {
+		return
+	}
+	sort.Strings(candidates)
+
+	if !config.PruneEnabled {
+		for _, name := range candidates {
+			plan.warn(name, fmt.Sprintf("Project %s was removed from the repository but still exists in Arcane (set PRUNE_ENABLED=true to remove it)", name))
+		}
+		return
+	}
+
+	// An empty or mostly-missing checkout looks exactly like "everything was
+	// deleted"; refuse rather than tearing down every stack.
+	if len(inv.DiskProjects) == 0 {
+		plan.fail("", fmt.Sprintf("Refusing to prune %d project(s): no projects found on disk", len(candidates)))
+		return
+	}
+	if config.PruneMaxPerRun >= 0 && len(candidates) > config.PruneMaxPerRun {
+		plan.fail("", fmt.Sprintf("Refusing to prune %d project(s), which exceeds PRUNE_MAX_PER_RUN=%d: %v", len(candidates), config.PruneMaxPerRun, candidates))
+		return
+	}
+
+	for _, name := range candidates {
+		target := state.Projects[name].settings(config, name)
+		change := PlannedChange{Project: name, Action: actionPrune, Reason: "folder removed from the repository", settings: target}
+		if projects := inv.arcaneProjects(target.EnvID, target.Name); len(projects) > 0 {
+			change.ProjectID = selectPreferredProjectID(projects)
+		} else {
+			change.Reason = "folder removed from the repository; already gone from Arcane"
+		}
+		plan.add(change)
+	}
+}
+
+// pruneProject brings a project down and deletes it from Arcane, then drops
+// it from the sync state.
+func pruneProject(ctx context.Context, config Config, client *arcane.Client, state *SyncState, change PlannedChange) error {
+	if change.ProjectID == "" {
+		logInfo(fmt.Sprintf("Project %s is already gone from Arcane, forgetting it", change.Project))
+		state.forget(config.StateFile, change.Project)
+		return nil
+	}
+
+	// A 404 means someone removed it in the meantime, which is the goal anyway
+	logInfo(fmt.Sprintf("Stopping project: %s", change.Project))
+	if err := client.DownProject(ctx, config.ArcaneEnvID, change.ProjectID); err != nil && !arcane.IsNotFound(err) {
+		return fmt.Errorf("stop (ID: %s): %w", change.ProjectID, err)
+	}
+
+	logInfo(fmt.Sprintf("Deleting project: %s", change.Project))
+	if err := client.DeleteProject(ctx, config.ArcaneEnvID, change.ProjectID, arcane.DeleteOptions{RemoveFiles: true}); err != nil && !arcane.IsNotFound(err) {
+		return fmt.Errorf("delete (ID: %s): %w", change.ProjectID, err)
+	}
+
+	state.forget(config.StateFile, change.Project)
+	logSuccess(fmt.Sprintf("Pruned project: %s", change.Project))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// rollbackProject re-applies the content of the last successfully deployed
+// commit after deploying change failed with deployErr. On success the project
+// is pinned to that commit until a commit changes it again. The returned
+// error reports the failed deploy either way, so the run still fails.
+func rollbackProject(ctx context.Context, config Config, client *arcane.Client, state *SyncState, commit string, change PlannedChange, deployErr error) error {
+	entry, tracked := state.Projects[change.Project]
+	if !tracked || entry.ContentHash == change.content.Hash() {
+		// Nothing different to go back to
+		return deployErr
+	}
+
+	// The failure may have used up the project's deadline; the rollback gets
+	// one of its own
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.ProjectTimeout)
+	defer cancel()
+
+	logWarning(fmt.Sprintf("Rolling back project %s to %s: %v", change.Project, shortCommit(entry.Commit), deployErr))
+	if err := redeployCommit(ctx, config, client, change, entry); err != nil {
+		return fmt.Errorf("%w; rollback to %s failed: %v", deployErr, shortCommit(entry.Commit), err)
+	}
+
+	state.recordRolledBack(config.StateFile, change.Project, commit, change.content, deployErr)
+	logSuccess(fmt.Sprintf("Rolled back project %s to %s; it stays pinned there until a commit changes it", change.Project, shortCommit(entry.Commit)))
+	return fmt.Errorf("%w; rolled back to %s", deployErr, shortCommit(entry.Commit))
+}
+
+// redeployCommit pushes a project's content as of entry.Commit to Arcane and
+// redeploys it.
+func redeployCommit(ctx context.Context, config Config, client *arcane.Client, change PlannedChange, entry ProjectSyncState) error {
+	worktree, cleanup, err := checkoutWorktree(ctx, config.RepoPath, entry.Commit)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	oldConfig := config
+	oldConfig.RepoPath = worktree
+	content, err := readProjectContent(ctx, oldConfig, change.Project)
+	if err != nil {
+		return fmt.Errorf("failed to read the previous version: %w", err)
+	}
+	if content.Hash() != entry.ContentHash {
+		// E.g. the host-local .env changed since
+		logWarning(fmt.Sprintf("Project %s at %s no longer matches what was deployed from it; rolling back anyway", change.Project, shortCommit(entry.Commit)))
+	}
+
+	logInfo(fmt.Sprintf("Restoring project configuration: %s", change.Project))
+	if err := client.UpdateProject(ctx, config.ArcaneEnvID, change.ProjectID, arcane.UpdateProjectRequest{
+		ComposeContent: content.Compose,
+		EnvContent:     content.Env,
+	}); err != nil {
+		return fmt.Errorf("update config: %w", err)
+	}
+	logInfo(fmt.Sprintf("Redeploying project: %s", change.Project))
+	if err := redeploy(ctx, config, client, change.ProjectID, change.settings); err != nil {
+		return fmt.Errorf("redeploy: %w", err)
+	}
+	return verifyHealth(ctx, config, client, change.Project, change.ProjectID)
+}
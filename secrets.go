@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// encryptedEnvPatterns match env files kept encrypted in a project folder.
+// They are decrypted in memory and layered over .env, so their values win.
+var encryptedEnvPatterns = []string{".env.enc", "*.sops.env"}
+
+var (
+	ageHeaders = [][]byte{[]byte("age-encryption.org/"), []byte("-----BEGIN AGE ENCRYPTED FILE-----")}
+	sopsDotenv = regexp.MustCompile(`(?m)^sops_mac=`)
+)
+
+func isEncryptedEnvFile(relPath string) bool {
+	for _, pattern := range encryptedEnvPatterns {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readEncryptedEnv decrypts a project's encrypted env files, in name order.
+// Plaintext never leaves memory: sops and age write it to a pipe.
+func readEncryptedEnv(ctx context.Context, config Config, projectName string) ([]envSource, error) {
+	projectPath := filepath.Join(config.RepoPath, projectName)
+	entries, err := os.ReadDir(projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project folder: %w", err)
+	}
+	var encrypted []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isEncryptedEnvFile(entry.Name()) {
+			encrypted = append(encrypted, entry.Name())
+		}
+	}
+	sort.Strings(encrypted)
+
+	var sources []envSource
+	for _, name := range encrypted {
+		if config.SkipDecrypt {
+			if err := checkEncryptedEnvFile(filepath.Join(projectPath, name), path.Join(projectName, name)); err != nil {
+				return nil, err
+			}
+			sources = append(sources, envSource{file: path.Join(projectName, name), encrypted: true})
+			continue
+		}
+		content, err := decryptEnvFile(ctx, config, filepath.Join(projectPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		sources = append(sources, envSource{file: path.Join(projectName, name), content: content})
+	}
+	return sources, nil
+}
+
+// decryptEnvFile decrypts a SOPS dotenv file with sops, or an age file with
+// age. A file that is neither is refused rather than uploaded as it is, in
+// case it holds secrets committed in plaintext by mistake.
+func decryptEnvFile(ctx context.Context, config Config, file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case isAgeEncrypted(data):
+		if config.AgeKeyFile == "" {
+			return "", errors.New("SOPS_AGE_KEY_FILE is required to decrypt age files")
+		}
+		cmd = exec.CommandContext(ctx, "age", "--decrypt", "--identity", config.AgeKeyFile)
+		cmd.Env = childEnviron()
+		cmd.Stdin = bytes.NewReader(data)
+	case sopsDotenv.Match(data):
+		cmd = exec.CommandContext(ctx, "sops", "--decrypt", "--input-type", "dotenv", "--output-type", "dotenv", file)
+		cmd.Env = childEnviron()
+		if config.AgeKeyFile != "" {
+			cmd.Env = append(cmd.Env, "SOPS_AGE_KEY_FILE="+config.AgeKeyFile)
+		}
+	default:
+		return "", errors.New("not encrypted with sops or age")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = 10 * time.Second
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// checkEncryptedEnvFile checks what can be checked without the key: that the
+// file is encrypted with sops or age, and that a SOPS dotenv file is still
+// made of KEY=VALUE lines. relPath is the file as reported in errors.
+func checkEncryptedEnvFile(file, relPath string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isAgeEncrypted(data):
+		return nil
+	case sopsDotenv.Match(data):
+		if _, problems := parseEnvFile(envSource{file: relPath, content: string(data)}); len(problems) > 0 {
+			return problems[0]
+		}
+		return nil
+	}
+	return &fileProblem{File: relPath, Line: 1, Msg: "not encrypted with sops or age"}
+}
+
+func isAgeEncrypted(data []byte) bool {
+	for _, header := range ageHeaders {
+		if bytes.HasPrefix(data, header) {
+			return true
+		}
+	}
+	return false
+}
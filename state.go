@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const stateFileVersion = 1
+
+// SyncState is the durable record of what arcane-gitops last applied to Arcane.
+// It survives between runs so a project that failed mid-run is retried on the
+// next run even when git itself has not moved.
+type SyncState struct {
+	Version  int                         `json:"version"`
+	Projects map[string]ProjectSyncState `json:"projects"`
+}
+
+// ProjectSyncState is written only after a project's update and redeploy both succeeded.
+type ProjectSyncState struct {
+	Commit      string    `json:"commit"`
+	ContentHash string    `json:"contentHash"`
+	FilesHash   string    `json:"filesHash,omitempty"`
+	SyncedAt    time.Time `json:"syncedAt"`
+	// Where the project was deployed, so it can be found once its folder is
+	// gone. Entries from older versions leave them empty: the folder name in
+	// ARCANE_ENV_ID.
+	ArcaneName string `json:"arcaneName,omitempty"`
+	EnvID      string `json:"envId,omitempty"`
+	// RolledBack is set while the project is pinned to Commit because a newer
+	// version failed to deploy and was rolled back
+	RolledBack *RollbackRecord `json:"rolledBack,omitempty"`
+}
+
+// RollbackRecord identifies the content that failed, so it isn't deployed
+// again until a commit changes the project.
+type RollbackRecord struct {
+	FailedCommit string    `json:"failedCommit"`
+	ContentHash  string    `json:"contentHash"`
+	FilesHash    string    `json:"filesHash,omitempty"`
+	Reason       string    `json:"reason"`
+	At           time.Time `json:"at"`
+}
+
+// settings returns the default settings of a tracked project with the Arcane
+// name and environment it was deployed to.
+func (e ProjectSyncState) settings(config Config, projectName string) ProjectSettings {
+	settings := defaultProjectSettings(config, projectName)
+	settings.EnvID = config.ArcaneEnvID
+	if e.ArcaneName != "" {
+		settings.Name = e.ArcaneName
+	}
+	if e.EnvID != "" {
+		settings.EnvID = e.EnvID
+	}
+	return settings
+}
+
+// pinned reports whether content is the version that was rolled back.
+func (e ProjectSyncState) pinned(content *ProjectContent) bool {
+	return e.RolledBack != nil && e.RolledBack.ContentHash == content.Hash() && e.RolledBack.FilesHash == content.FilesHash
+}
+
+// ProjectContent is the payload pushed to Arcane for a single project.
+type ProjectContent struct {
+	Compose string // Merged, when the project has several compose files
+	Env     string // Rendered from the env layers, see readProjectEnv
+	// ComposeFiles are the files Compose was read from, relative to the
+	// project folder
+	ComposeFiles []string
+	// FilesHash covers the other tracked files in the project folder that
+	// match the sync filter (Dockerfiles, mounted config, ...). They aren't
+	// uploaded, but a change to them still warrants a redeploy.
+	FilesHash string
+
+	envSources []envSource // The layers Env was rendered from, for validation
+}
+
+func loadSyncState(path string) (*SyncState, error) {
+	state := &SyncState{
+		Version:  stateFileVersion,
+		Projects: make(map[string]ProjectSyncState),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if state.Projects == nil {
+		state.Projects = make(map[string]ProjectSyncState)
+	}
+	return state, nil
+}
+
+// save writes the state atomically so a crash never leaves a truncated file behind.
+func (s *SyncState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once renamed
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to flush state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+func (s *SyncState) markSynced(commit string, change PlannedChange) {
+	s.Projects[change.Project] = ProjectSyncState{
+		Commit:      commit,
+		ContentHash: change.content.Hash(),
+		FilesHash:   change.content.FilesHash,
+		SyncedAt:    time.Now().UTC(),
+		ArcaneName:  change.settings.Name,
+		EnvID:       change.settings.EnvID,
+	}
+}
+
+// recordSynced marks a project as synced and persists the state immediately,
+// so progress made before a crash is not lost.
+func (s *SyncState) recordSynced(path, commit string, change PlannedChange) {
+	s.markSynced(commit, change)
+	if err := s.save(path); err != nil {
+		logError(fmt.Sprintf("Failed to persist sync state for project %s: %v", change.Project, err))
+	}
+}
+
+// recordRolledBack pins a project to its last good version after content
+// from failedCommit was rolled back, and persists the state.
+func (s *SyncState) recordRolledBack(path, projectName, failedCommit string, failed *ProjectContent, reason error) {
+	entry := s.Projects[projectName]
+	entry.RolledBack = &RollbackRecord{
+		FailedCommit: failedCommit,
+		ContentHash:  failed.Hash(),
+		FilesHash:    failed.FilesHash,
+		Reason:       reason.Error(),
+		At:           time.Now().UTC(),
+	}
+	s.Projects[projectName] = entry
+	if err := s.save(path); err != nil {
+		logError(fmt.Sprintf("Failed to persist sync state after rolling back project %s: %v", projectName, err))
+	}
+}
+
+// find returns the key of the tracked project deployed as name in an
+// environment.
+func (s *SyncState) find(config Config, name, envID string) (string, bool) {
+	for key, entry := range s.Projects {
+		if target := entry.settings(config, key); target.Name == name && target.EnvID == envID {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// forget drops a project from the state and persists the change.
+func (s *SyncState) forget(path, projectName string) {
+	delete(s.Projects, projectName)
+	if err := s.save(path); err != nil {
+		logError(fmt.Sprintf("Failed to persist sync state after removing project %s: %v", projectName, err))
+	}
+}
+
+func readProjectContent(ctx context.Context, config Config, projectName string) (*ProjectContent, error) {
+	settings, err := loadProjectSettings(config, projectName)
+	if err != nil {
+		return nil, err
+	}
+	composeFiles, err := composeFilesFor(config, projectName, settings)
+	if err != nil {
+		return nil, err
+	}
+	composeContent, err := loadCompose(config, projectName, composeFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	envSources, err := readProjectEnv(ctx, config, projectName, settings.EnvID)
+	if err != nil {
+		return nil, err
+	}
+	env, err := renderEnv(envSources)
+	if err != nil {
+		return nil, err
+	}
+
+	filesHash, err := hashProjectFiles(ctx, config, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProjectContent{
+		Compose:      composeContent,
+		ComposeFiles: composeFiles,
+		Env:          env,
+		FilesHash:    filesHash,
+		envSources:   envSources,
+	}, nil
+}
+
+// hashProjectFiles hashes the git blob IDs of the project's tracked files that
+// match the sync filter. Using the index rather than reading files keeps this
+// cheap and ignores untracked runtime data living next to the compose file.
+func hashProjectFiles(ctx context.Context, config Config, projectName string) (string, error) {
+	cmd := gitCommand(ctx, "-C", config.RepoPath, "ls-files", "-s", "--", projectName+"/")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	h := sha256.New()
+	matched := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Format: "<mode> <object> <stage>\t<path>"
+		meta, file, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) < 2 {
+			continue
+		}
+
+		relPath := strings.TrimPrefix(file, projectName+"/")
+		if isProjectPayloadFile(relPath) || relPath == projectSettingsFile || !config.SyncFilter.Matches(relPath) {
+			continue
+		}
+
+		fmt.Fprintf(h, "%s %s\n", fields[1], relPath)
+		matched++
+	}
+
+	if matched == 0 {
+		return "", nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hash identifies the content independently of which commit it came from, so
+// commits that don't touch a project don't cause it to be redeployed.
+func (pc *ProjectContent) Hash() string {
+	h := sha256.New()
+	h.Write([]byte(pc.Compose))
+	h.Write([]byte{0})
+	h.Write([]byte(pc.Env))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncStateSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	state, err := loadSyncState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != stateFileVersion || len(state.Projects) != 0 {
+		t.Fatalf("missing state file = %+v, want an empty state", state)
+	}
+
+	content := &ProjectContent{Compose: testCompose, Env: "A=1\n", FilesHash: "files"}
+	state.markSynced("c1", PlannedChange{Project: "apps/web", content: content, settings: ProjectSettings{Name: "web", EnvID: "2"}})
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("state directory has %d files, want only the state file", len(entries))
+	}
+
+	loaded, err := loadSyncState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := loaded.Projects["apps/web"], state.Projects["apps/web"]
+	if got.Commit != "c1" || got.ContentHash != content.Hash() || got.FilesHash != "files" || got.ArcaneName != "web" || got.EnvID != "2" ||
+		!got.SyncedAt.Equal(want.SyncedAt) || got.RolledBack != nil {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSyncState(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("corrupt state file: err = %v, want one naming the file", err)
+	}
+}
+
+func TestMarkSyncedClearsRollback(t *testing.T) {
+	state := &SyncState{Projects: map[string]ProjectSyncState{
+		"web": {Commit: "c1", ContentHash: "good", RolledBack: &RollbackRecord{FailedCommit: "c2", ContentHash: "bad"}},
+	}}
+	state.markSynced("c3", PlannedChange{Project: "web", content: &ProjectContent{Compose: testCompose}, settings: ProjectSettings{Name: "web", EnvID: "0"}})
+	if entry := state.Projects["web"]; entry.Commit != "c3" || entry.RolledBack != nil {
+		t.Errorf("entry = %+v, want synced at c3 and no longer pinned", entry)
+	}
+}
+
+func TestProjectSyncStatePinned(t *testing.T) {
+	content := &ProjectContent{Compose: testCompose, FilesHash: "files"}
+	tests := []struct {
+		name       string
+		rolledBack *RollbackRecord
+		want       bool
+	}{
+		{"not rolled back", nil, false},
+		{"rolled back content", &RollbackRecord{ContentHash: content.Hash(), FilesHash: "files"}, true},
+		{"content changed since", &RollbackRecord{ContentHash: "other", FilesHash: "files"}, false},
+		{"project files changed since", &RollbackRecord{ContentHash: content.Hash(), FilesHash: "other"}, false},
+	}
+	for _, tt := range tests {
+		entry := ProjectSyncState{ContentHash: "good", RolledBack: tt.rolledBack}
+		if got := entry.pinned(content); got != tt.want {
+			t.Errorf("%s: pinned = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSyncStateFind(t *testing.T) {
+	config := Config{ArcaneEnvID: "0"}
+	state := &SyncState{Projects: map[string]ProjectSyncState{
+		"apps/web": {},                                   // Older entry: deployed as the folder's default name
+		"media":    {ArcaneName: "jellyfin", EnvID: "2"}, // Renamed, in another environment
+	}}
+	tests := []struct {
+		name, envID string
+		want        string // "" when not tracked
+	}{
+		{"apps-web", "0", "apps/web"},
+		{"apps-web", "2", ""},
+		{"jellyfin", "2", "media"},
+		{"jellyfin", "0", ""},
+		{"media", "2", ""},
+	}
+	for _, tt := range tests {
+		key, found := state.find(config, tt.name, tt.envID)
+		if key != tt.want || found != (tt.want != "") {
+			t.Errorf("find(%q, %q) = %q, %v, want %q", tt.name, tt.envID, key, found, tt.want)
+		}
+	}
+}
+
+func TestHashProjectFiles(t *testing.T) {
+	config := testRepo(t, map[string]string{
+		"web/compose.yaml":        testCompose,
+		"web/.env":                "A=1\n",
+		"web/.arcane-gitops.yaml": "order: 1\n",
+		"web/Dockerfile":          "FROM nginx:1.29\n",
+		"web/README.md":           "# web\n",
+		"db/compose.yaml":         testCompose,
+	})
+	hash := func() string {
+		t.Helper()
+		h, err := hashProjectFiles(context.Background(), config, "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	base := hash()
+	if base == "" {
+		t.Fatal("hash is empty with a Dockerfile in the project")
+	}
+	if h, err := hashProjectFiles(context.Background(), config, "db"); err != nil || h != "" {
+		t.Errorf("project without other files: hash = %q, %v, want empty", h, err)
+	}
+
+	// Uploaded content, settings and untracked files aren't covered
+	commitFiles(t, config.RepoPath, map[string]string{
+		"web/compose.yaml":        testCompose + "  db:\n    image: postgres:16\n",
+		"web/.env":                "A=2\n",
+		"web/.arcane-gitops.yaml": "order: 2\n",
+	})
+	writeFiles(t, config.RepoPath, map[string]string{"web/data/db.sqlite": "runtime"})
+	if h := hash(); h != base {
+		t.Errorf("hash changed without a change to the project files")
+	}
+
+	commitFiles(t, config.RepoPath, map[string]string{"web/README.md": "# web server\n"})
+	readme := hash()
+	if readme == base {
+		t.Errorf("hash unchanged after editing README.md")
+	}
+	config.SyncFilter = PathFilter{Exclude: []string{"*.md"}}
+	commitFiles(t, config.RepoPath, map[string]string{"web/README.md": "# the web server\n"})
+	if h := hash(); h == readme {
+		t.Errorf("hash unchanged after excluding README.md")
+	}
+	excluded := hash()
+	commitFiles(t, config.RepoPath, map[string]string{"web/README.md": "# web\n"})
+	if h := hash(); h != excluded {
+		t.Errorf("hash changed after editing an excluded file")
+	}
+
+	commitFiles(t, config.RepoPath, map[string]string{"web/Dockerfile": "FROM nginx:1.30\n"})
+	if h := hash(); h == excluded {
+		t.Errorf("hash unchanged after editing the Dockerfile")
+	}
+}
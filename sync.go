@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/secunit/arcane-gitops/pkg/arcane"
+)
+
+// preservedLocalFiles are untracked, host-local files that survive the force
+// sync to the remote (git clean exclusions).
+var preservedLocalFiles = []string{".env.global", "*.env.local", ".env"}
+
+// errSyncInterrupted is returned when a stop was requested between projects.
+// The project being worked on when the request arrived is finished, within
+// its PROJECT_TIMEOUT.
+var errSyncInterrupted = errors.New("sync interrupted before all projects were processed")
+
+// errSyncTimedOut is returned when SYNC_TIMEOUT ran out between projects.
+var errSyncTimedOut = errors.New("sync timed out (SYNC_TIMEOUT) before all projects were processed")
+
+// runSync performs one full pass: force-sync the repository to the remote and
+// reconcile every project on disk with Arcane. Cancelling ctx stops the pass
+// after the current project; the whole pass is bounded by SYNC_TIMEOUT.
+func runSync(ctx context.Context, config Config, client *arcane.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, config.SyncTimeout)
+	defer cancel()
+
+	logInfo("Starting compose sync check")
+	logInfo(fmt.Sprintf("Repository: %s", config.RepoPath))
+
+	oldCommit, err := syncGitRepository(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	newCommit, err := getCurrentCommit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get new commit: %w", err)
+	}
+
+	// Load the record of what was last applied; this is what we reconcile against
+	state, err := loadSyncState(config.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	inv, err := gatherInventory(ctx, config, client, state)
+	if err != nil {
+		return err
+	}
+
+	plan := buildSyncPlan(ctx, config, state, inv, detectChangedProjects(ctx, oldCommit, newCommit, config, inv.DiskProjects), newCommit)
+	return applySyncPlan(ctx, config, client, state, plan)
+}
+
+// applySyncPlan carries out a plan, recording each project in the sync state
+// as soon as it has been applied successfully.
+func applySyncPlan(ctx context.Context, config Config, client *arcane.Client, state *SyncState, plan *SyncPlan) error {
+	for _, msg := range plan.Warnings {
+		logWarning(msg.Message)
+	}
+	for _, msg := range plan.Errors {
+		logError(msg.Message)
+	}
+	failedProjects := len(plan.Errors)
+
+	for _, msg := range plan.Moved {
+		logInfo(msg.Message)
+		state.forget(config.StateFile, msg.Project)
+	}
+
+	if len(plan.Changes) == 0 {
+		if failedProjects > 0 {
+			return fmt.Errorf("%d project(s) failed to sync; they will be retried on the next run", failedProjects)
+		}
+		logSuccess("All projects are in sync, no changes needed")
+		return nil
+	}
+
+	counts := plan.countActions()
+	logInfo(fmt.Sprintf("Applying %d change(s): %d to create, %d to update, %d to redeploy, %d to prune",
+		len(plan.Changes), counts[actionCreate], counts[actionUpdate], counts[actionRedeploy], counts[actionPrune]))
+
+	// With several environments, each is reported on its own. A failure in
+	// one doesn't stop the others from being applied.
+	envIDs := plan.environments()
+	envChanges := make(map[string]int)
+	envFailures := make(map[string]int)
+	for _, change := range plan.Changes {
+		envChanges[change.Environment]++
+	}
+
+	currentEnv := ""
+	for _, change := range plan.Changes {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errSyncTimedOut
+		} else if ctx.Err() != nil {
+			return errSyncInterrupted
+		}
+		if len(envIDs) > 1 && change.Environment != currentEnv {
+			currentEnv = change.Environment
+			logInfo(fmt.Sprintf("Environment %s: applying %d change(s)", currentEnv, envChanges[currentEnv]))
+		}
+
+		ctx, cancel := projectContext(ctx, config.ProjectTimeout)
+		projectConfig := change.settings.forProject(config)
+		var err error
+		switch change.Action {
+		case actionAdopt:
+			logInfo(fmt.Sprintf("Adopting project into sync state: %s (%s)", change.Project, change.Reason))
+			state.recordSynced(config.StateFile, plan.TargetCommit, change)
+		case actionCreate:
+			err = createProject(ctx, projectConfig, client, state, plan.TargetCommit, change)
+		case actionUpdate:
+			err = updateProject(ctx, projectConfig, client, state, plan.TargetCommit, change)
+		case actionRedeploy:
+			err = redeployProject(ctx, projectConfig, client, state, plan.TargetCommit, change)
+		case actionPrune:
+			err = pruneProject(ctx, projectConfig, client, state, change)
+		}
+		cancel()
+
+		if err != nil {
+			logError(fmt.Sprintf("Failed to %s project %s: %v", change.Action, change.Project, err))
+			failedProjects++
+			envFailures[change.Environment]++
+		}
+	}
+
+	if len(envIDs) > 1 {
+		for _, envID := range envIDs {
+			if failed := envFailures[envID]; failed > 0 {
+				logError(fmt.Sprintf("Environment %s: %d of %d change(s) failed", envID, failed, envChanges[envID]))
+			} else {
+				logSuccess(fmt.Sprintf("Environment %s: %d change(s) applied", envID, envChanges[envID]))
+			}
+		}
+	}
+
+	if failedProjects > 0 {
+		return fmt.Errorf("%d project(s) failed to sync; they will be retried on the next run", failedProjects)
+	}
+
+	logSuccess("Compose sync completed successfully!")
+	return nil
+}
+
+// projectContext bounds the work on one project by PROJECT_TIMEOUT (and what
+// is left of the run's deadline). It is not cancelled along with ctx, so a stop
+// request doesn't abandon a project halfway through a deploy.
+func projectContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(timeout)
+	if runDeadline, ok := ctx.Deadline(); ok && runDeadline.Before(deadline) {
+		deadline = runDeadline
+	}
+	return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+}
+
+func createProject(ctx context.Context, config Config, client *arcane.Client, state *SyncState, commit string, change PlannedChange) error {
+	projectName := change.settings.Name
+
+	// Guard: double-check with server-side search to avoid creating duplicates
+	existing, err := client.FindProjectsByName(ctx, config.ArcaneEnvID, projectName)
+	if err != nil {
+		logWarning(fmt.Sprintf("Could not verify whether project %s exists (will attempt create): %v", projectName, err))
+	} else if len(existing) > 0 {
+		var ids []string
+		for _, p := range existing {
+			ids = append(ids, p.ID)
+		}
+		// Not recorded as synced, so the next run adopts or updates it
+		logWarning(fmt.Sprintf("Project %s already exists in Arcane (IDs: %s). Skipping create to avoid duplicates.", projectName, strings.Join(ids, ", ")))
+		return nil
+	}
+
+	logInfo(fmt.Sprintf("Creating project: %s", projectName))
+	created, err := client.CreateProject(ctx, config.ArcaneEnvID, arcane.CreateProjectRequest{
+		Name:           projectName,
+		ComposeContent: change.content.Compose,
+		EnvContent:     change.content.Env,
+	})
+	if err != nil {
+		return err
+	}
+	projectID := created.ID
+	logSuccess(fmt.Sprintf("Created project: %s (ID: %s)", projectName, projectID))
+
+	if !change.settings.AutoStart {
+		logInfo(fmt.Sprintf("Not starting project %s (auto_start is off)", projectName))
+		state.recordSynced(config.StateFile, commit, change)
+		return nil
+	}
+
+	// Start the newly created project
+	logInfo(fmt.Sprintf("Starting project: %s", projectName))
+	if err := client.StartProject(ctx, config.ArcaneEnvID, projectID); err != nil {
+		logWarning(fmt.Sprintf("Failed to start project %s (ID: %s): %v", projectName, projectID, err))
+		// Try redeploy as fallback
+		if err := redeploy(ctx, config, client, projectID, change.settings); err != nil {
+			return fmt.Errorf("redeploy (ID: %s): %w", projectID, err)
+		}
+		logSuccess(fmt.Sprintf("Redeployed project: %s", projectName))
+	} else {
+		logSuccess(fmt.Sprintf("Started project: %s", projectName))
+	}
+	if err := verifyHealth(ctx, config, client, projectName, projectID); err != nil {
+		return err
+	}
+
+	state.recordSynced(config.StateFile, commit, change)
+	return nil
+}
+
+func updateProject(ctx context.Context, config Config, client *arcane.Client, state *SyncState, commit string, change PlannedChange) error {
+	// Update project configuration in Arcane
+	logInfo(fmt.Sprintf("Updating project configuration: %s (%s)", change.Project, change.Reason))
+	updateErr := client.UpdateProject(ctx, config.ArcaneEnvID, change.ProjectID, arcane.UpdateProjectRequest{
+		ComposeContent: change.content.Compose,
+		EnvContent:     change.content.Env,
+	})
+	if updateErr != nil {
+		logWarning(fmt.Sprintf("Failed to update project %s (ID: %s) config: %v", change.Project, change.ProjectID, updateErr))
+	}
+
+	// Redeploy the project
+	logInfo(fmt.Sprintf("Redeploying project: %s", change.Project))
+	if err := redeploy(ctx, config, client, change.ProjectID, change.settings); err != nil {
+		err = fmt.Errorf("redeploy (ID: %s): %w", change.ProjectID, err)
+		if updateErr == nil && config.RollbackEnabled {
+			return rollbackProject(ctx, config, client, state, commit, change, err)
+		}
+		return err
+	}
+	logSuccess(fmt.Sprintf("Redeployed project: %s", change.Project))
+
+	// Only a project whose new config actually landed counts as synced;
+	// otherwise it stays pending and is retried next run.
+	if updateErr != nil {
+		return fmt.Errorf("update config (ID: %s): %w", change.ProjectID, updateErr)
+	}
+	if err := verifyHealth(ctx, config, client, change.Project, change.ProjectID); err != nil {
+		if config.RollbackEnabled {
+			return rollbackProject(ctx, config, client, state, commit, change, err)
+		}
+		return err
+	}
+	state.recordSynced(config.StateFile, commit, change)
+	return nil
+}
+
+func redeployProject(ctx context.Context, config Config, client *arcane.Client, state *SyncState, commit string, change PlannedChange) error {
+	logInfo(fmt.Sprintf("Redeploying project: %s (%s)", change.Project, change.Reason))
+	if err := redeploy(ctx, config, client, change.ProjectID, change.settings); err != nil {
+		return fmt.Errorf("redeploy (ID: %s): %w", change.ProjectID, err)
+	}
+	logSuccess(fmt.Sprintf("Redeployed project: %s", change.Project))
+	if err := verifyHealth(ctx, config, client, change.Project, change.ProjectID); err != nil {
+		return err
+	}
+
+	state.recordSynced(config.StateFile, commit, change)
+	return nil
+}
+
+// redeploy recreates a project's containers from its current content, pulling
+// images as its pull policy says.
+func redeploy(ctx context.Context, config Config, client *arcane.Client, projectID string, settings ProjectSettings) error {
+	switch settings.PullPolicy {
+	case pullPolicyAlways:
+		return client.DeployProject(ctx, config.ArcaneEnvID, projectID, arcane.DeployOptions{Pull: true})
+	case pullPolicyMissing:
+		return client.DeployProject(ctx, config.ArcaneEnvID, projectID, arcane.DeployOptions{})
+	}
+	return client.RedeployProject(ctx, config.ArcaneEnvID, projectID)
+}
+
+// syncGitRepository force-resets the local checkout to the remote branch and
+// returns the commit that was checked out before.
+func syncGitRepository(ctx context.Context, config Config) (string, error) {
+	// Change to repo directory
+	if err := os.Chdir(config.RepoPath); err != nil {
+		return "", fmt.Errorf("failed to change to repository directory: %w", err)
+	}
+
+	// Fetch latest from remote
+	logInfo("Fetching from remote...")
+	if err := runGitCommand(ctx, "fetch", "origin"); err != nil {
+		return "", fmt.Errorf("failed to fetch from remote: %w", err)
+	}
+
+	// Get current branch
+	branch, err := getCurrentBranch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	logInfo(fmt.Sprintf("Current branch: %s", branch))
+
+	// Check git status
+	status, err := getGitStatus(ctx, branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to get git status: %w", err)
+	}
+
+	// Get current commit before any changes
+	oldCommit, err := getCurrentCommit(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current commit: %w", err)
+	}
+
+	// Handle diverged state (both ahead and behind)
+	// GitOps principle: Remote is always the source of truth
+	if status.Ahead > 0 && status.Behind > 0 {
+		logWarning(fmt.Sprintf("Local has diverged (ahead by %d, behind by %d)", status.Ahead, status.Behind))
+		logWarning("Remote is source of truth - discarding local commits and syncing to remote")
+
+		// Discard local changes and commits, force sync to remote
+		if err := runGitCommand(ctx, "fetch", "origin", branch); err != nil {
+			return "", fmt.Errorf("failed to fetch: %w", err)
+		}
+		if err := runGitCommand(ctx, "reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
+			return "", fmt.Errorf("failed to reset to remote: %w", err)
+		}
+		// Clean untracked files but preserve local env files
+		if err := runGitCommand(ctx, gitCleanArgs()...); err != nil {
+			logWarning(fmt.Sprintf("Failed to clean untracked files: %v", err))
+		}
+		logSuccess("Successfully force-synced to remote")
+	} else if status.Ahead > 0 {
+		// Only ahead (not behind) - this is unusual for GitOps but handle it
+		logWarning(fmt.Sprintf("Local is ahead by %d commits (unusual for GitOps)", status.Ahead))
+		logWarning("Remote is source of truth - discarding local commits")
+
+		if err := runGitCommand(ctx, "fetch", "origin", branch); err != nil {
+			return "", fmt.Errorf("failed to fetch: %w", err)
+		}
+		if err := runGitCommand(ctx, "reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
+			return "", fmt.Errorf("failed to reset to remote: %w", err)
+		}
+		logSuccess("Successfully reset to remote")
+		// Remote hasn't changed; we're only discarding local commits
+	}
+
+	// Handle behind (need to pull) - only if not already handled in diverged case
+	if status.Behind > 0 && status.Ahead == 0 {
+		logInfo(fmt.Sprintf("Local is behind by %d commits, pulling...", status.Behind))
+
+		// GitOps principle: Remote is the source of truth
+		// Discard any local changes and force sync to remote
+		if status.HasLocalChange {
+			logWarning("Local changes detected, discarding (remote is source of truth)...")
+			// Reset any staged changes
+			if err := runGitCommand(ctx, "reset", "--hard", "HEAD"); err != nil {
+				logWarning(fmt.Sprintf("Failed to reset HEAD: %v", err))
+			}
+			// Clean untracked files but preserve local env files
+			if err := runGitCommand(ctx, gitCleanArgs()...); err != nil {
+				logWarning(fmt.Sprintf("Failed to clean untracked files: %v", err))
+			}
+		}
+
+		// Force local branch to match remote exactly
+		if err := runGitCommand(ctx, "fetch", "origin", branch); err != nil {
+			return "", fmt.Errorf("failed to fetch: %w", err)
+		}
+
+		// Reset local branch to match remote
+		if err := runGitCommand(ctx, "reset", "--hard", fmt.Sprintf("origin/%s", branch)); err != nil {
+			return "", fmt.Errorf("failed to reset to remote: %w", err)
+		}
+		logSuccess("Successfully synced to remote (force reset)")
+	}
+
+	// If both ahead and behind, we already handled it above
+	// The pull with rebase should handle this scenario
+
+	return oldCommit, nil
+}
+
+func gitCleanArgs() []string {
+	args := []string{"clean", "-fd"}
+	for _, pattern := range preservedLocalFiles {
+		args = append(args, "-e", pattern)
+	}
+	return args
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// runValidateCommand checks the projects in the checkout as they are. It needs
+// neither Arcane nor the network, so it can gate pull requests in CI.
+func runValidateCommand(args []string) int {
+	fs := newFlagSet("validate")
+	jsonOutput := fs.Bool("json", false, "print the problems as JSON")
+	noDecrypt := fs.Bool("no-decrypt", false, "check that encrypted env files are well formed without decrypting them, so no key is needed")
+	fs.Usage = func() { commandUsage(fs, "validate") }
+	names, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	config, err := buildConfig()
+	if err == nil && config.RepoPath == "" {
+		err = errors.New("COMPOSE_REPO_PATH environment variable is required")
+	}
+	if err == nil {
+		err = validateProjectsDir(config)
+	}
+	if err == nil {
+		err = validateEnvMap(config)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	config.SkipDecrypt = *noDecrypt
+	log.SetOutput(io.Discard)
+	if *jsonOutput {
+		consoleOutput = os.Stderr
+	}
+
+	projects, err := listDiskProjects(config)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to list disk projects: %v", err))
+		return exitError
+	}
+	policy, err := loadPolicy(config)
+	if err != nil {
+		logError(err.Error())
+		return exitError
+	}
+	for _, name := range names {
+		if !slices.Contains(projects, name) {
+			logError(fmt.Sprintf("No project %s in %s", name, config.RepoPath))
+			return exitError
+		}
+	}
+	if len(names) > 0 {
+		projects = names
+	}
+
+	report := ValidationReport{Valid: true}
+	for _, name := range projects {
+		result := ProjectValidation{Project: name, Valid: true}
+		problems, warnings := validateProject(context.Background(), config, policy, name)
+		for _, problem := range problems {
+			result.Valid, report.Valid = false, false
+			result.Problems = append(result.Problems, newValidationProblem(problem))
+		}
+		for _, warning := range warnings {
+			result.Warnings = append(result.Warnings, newValidationProblem(warning))
+		}
+		report.Projects = append(report.Projects, result)
+	}
+
+	if *jsonOutput {
+		if code := printJSON(report); code != exitOK {
+			return code
+		}
+		if !report.Valid {
+			return exitError
+		}
+		return exitOK
+	}
+
+	invalid := 0
+	for _, result := range report.Projects {
+		for _, warning := range result.Warnings {
+			logWarning(fmt.Sprintf("%s: %s", result.Project, warning))
+		}
+		if result.Valid {
+			logSuccess(fmt.Sprintf("%s: ok", result.Project))
+			continue
+		}
+		invalid++
+		for _, problem := range result.Problems {
+			logError(fmt.Sprintf("%s: %s", result.Project, problem))
+		}
+	}
+
+	if invalid > 0 {
+		logError(fmt.Sprintf("%d of %d project(s) are invalid", invalid, len(projects)))
+		return exitError
+	}
+	logSuccess(fmt.Sprintf("All %d project(s) are valid", len(projects)))
+	return exitOK
+}
+
+// ValidationReport is the JSON output of the validate command.
+type ValidationReport struct {
+	Valid    bool                `json:"valid"`
+	Projects []ProjectValidation `json:"projects"`
+}
+
+type ProjectValidation struct {
+	Project  string              `json:"project"`
+	Valid    bool                `json:"valid"`
+	Problems []ValidationProblem `json:"problems,omitempty"`
+	Warnings []ValidationProblem `json:"warnings,omitempty"` // Violations of warn policy rules
+}
+
+// ValidationProblem is one problem with a project. File, relative to the
+// repository root, and Line are set when the problem is at a known place;
+// Rule when it breaks the policy.
+type ValidationProblem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+func newValidationProblem(err error) ValidationProblem {
+	var problem *fileProblem
+	var violation *PolicyViolation
+	switch {
+	case errors.As(err, &problem):
+		return ValidationProblem{File: problem.File, Line: problem.Line, Message: problem.Msg}
+	case errors.As(err, &violation):
+		return ValidationProblem{File: violation.File, Line: violation.Line, Message: violation.Message, Rule: violation.Rule}
+	}
+	return ValidationProblem{Message: err.Error()}
+}
+
+func (p ValidationProblem) String() string {
+	msg := p.Message
+	if p.File != "" {
+		msg = fmt.Sprintf("%s:%d: %s", p.File, p.Line, msg)
+	}
+	if p.Rule != "" {
+		msg += " [" + p.Rule + "]"
+	}
+	return msg
+}
+
+// validateProject returns everything wrong with a project that would make
+// its sync fail or push something broken to Arcane, and the violations of
+// warn policy rules, which don't.
+func validateProject(ctx context.Context, config Config, policy *Policy, name string) ([]error, []error) {
+	settings, err := loadProjectSettings(config, name)
+	if err != nil {
+		// The compose files can't be read without the settings
+		return []error{err}, nil
+	}
+	if !settings.Enabled {
+		// Disabled projects are never pushed, so work in progress may be broken
+		return nil, nil
+	}
+
+	content, err := readProjectContent(ctx, config, name)
+	if err != nil {
+		return []error{err}, nil
+	}
+
+	var problems, warnings []error
+	if strings.TrimSpace(content.Compose) == "" {
+		problems = append(problems, errors.New("compose file is empty"))
+	} else {
+		// Checked whatever COMPOSE_VALIDATION says, so CI catches what a sync would push
+		project, composeProblems := validateCompose(config, name, content.ComposeFiles)
+		problems = append(problems, composeProblems...)
+		if project != nil {
+			for _, violation := range policy.evaluate(config, name, project) {
+				if violation.Severity == policyDeny {
+					problems = append(problems, violation)
+				} else {
+					warnings = append(warnings, violation)
+				}
+			}
+		}
+	}
+	for _, source := range content.envSources {
+		_, envProblems := parseEnvFile(source)
+		problems = append(problems, envProblems...)
+	}
+	return problems, warnings
+}
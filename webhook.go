@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHub caps webhook payloads at 25 MB; anything larger isn't a real push.
+const maxWebhookBodyBytes = 25 << 20
+
+// pushEvent is the subset of the push payload shared by GitHub, Gitea/Forgejo and GitLab.
+type pushEvent struct {
+	Ref   string `json:"ref"`
+	After string `json:"after"`
+}
+
+// webhookServer accepts push webhooks and asks the daemon for a sync once a
+// burst of pushes has settled.
+type webhookServer struct {
+	secret   string
+	repoPath string
+	debounce time.Duration
+	trigger  func()
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newWebhookServer(config Config, trigger func()) *webhookServer {
+	return &webhookServer{
+		secret:   config.WebhookSecret,
+		repoPath: config.RepoPath,
+		debounce: config.WebhookDebounce,
+		trigger:  trigger,
+	}
+}
+
+// start listens in the background until ctx is cancelled.
+func (w *webhookServer) start(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", w.handlePush)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Payloads are small; a client trickling one in doesn't get to hold
+		// the connection open
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		logInfo(fmt.Sprintf("Listening for git webhooks on %s/webhook", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError(fmt.Sprintf("Webhook listener failed: %v", err))
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx) // Best effort on the way out
+		w.mu.Lock()
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		w.mu.Unlock()
+	}()
+}
+
+func (w *webhookServer) handlePush(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes+1))
+	if err != nil {
+		http.Error(rw, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookBodyBytes {
+		http.Error(rw, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	provider, event, err := w.authenticate(r, body)
+	if err != nil {
+		logWarning(fmt.Sprintf("Rejected webhook from %s: %v", r.RemoteAddr, err))
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !isPushEvent(event) {
+		// e.g. GitHub's "ping" when the hook is created
+		writeWebhookResponse(rw, http.StatusOK, fmt.Sprintf("ignored %s event", event))
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		http.Error(rw, "invalid push payload", http.StatusBadRequest)
+		return
+	}
+
+	branch, err := getTrackedBranch(r.Context(), w.repoPath)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to determine tracked branch for webhook: %v", err))
+		http.Error(rw, "failed to determine tracked branch", http.StatusInternalServerError)
+		return
+	}
+	if push.Ref != "refs/heads/"+branch {
+		writeWebhookResponse(rw, http.StatusOK, fmt.Sprintf("ignored push to %s, tracking %s", push.Ref, branch))
+		return
+	}
+
+	logInfo(fmt.Sprintf("Received %s push to %s (%s)", provider, branch, shortCommit(push.After)))
+	w.scheduleSync()
+	writeWebhookResponse(rw, http.StatusAccepted, "sync scheduled")
+}
+
+// authenticate verifies the request with whichever scheme its provider uses
+// and returns the provider name and event type.
+func (w *webhookServer) authenticate(r *http.Request, body []byte) (string, string, error) {
+	// Gitea and Forgejo also send X-GitHub-Event for compatibility, so check them first
+	switch {
+	case r.Header.Get("X-Forgejo-Event") != "":
+		return "Forgejo", r.Header.Get("X-Forgejo-Event"), w.verifyHMAC(firstHeader(r, "X-Forgejo-Signature", "X-Gitea-Signature"), body)
+	case r.Header.Get("X-Gitea-Event") != "":
+		return "Gitea", r.Header.Get("X-Gitea-Event"), w.verifyHMAC(r.Header.Get("X-Gitea-Signature"), body)
+	case r.Header.Get("X-Gitlab-Event") != "":
+		return "GitLab", r.Header.Get("X-Gitlab-Event"), w.verifyToken(r.Header.Get("X-Gitlab-Token"))
+	case r.Header.Get("X-GitHub-Event") != "":
+		signature := r.Header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(signature, "sha256=") {
+			return "GitHub", "", errors.New("missing X-Hub-Signature-256")
+		}
+		return "GitHub", r.Header.Get("X-GitHub-Event"), w.verifyHMAC(strings.TrimPrefix(signature, "sha256="), body)
+	}
+	return "", "", errors.New("unrecognized webhook provider")
+}
+
+func (w *webhookServer) verifyHMAC(signature string, body []byte) error {
+	if signature == "" {
+		return errors.New("missing signature")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (w *webhookServer) verifyToken(token string) error {
+	if token == "" {
+		return errors.New("missing token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+		return errors.New("token mismatch")
+	}
+	return nil
+}
+
+// scheduleSync (re)starts the debounce timer, so a burst of pushes results in
+// a single sync once the pushes stop.
+func (w *webhookServer) scheduleSync() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, w.trigger)
+}
+
+func isPushEvent(event string) bool {
+	// GitLab uses "Push Hook", everyone else "push"
+	return strings.EqualFold(event, "push") || strings.EqualFold(event, "Push Hook")
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func writeWebhookResponse(rw http.ResponseWriter, status int, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(map[string]string{"message": message}) // Client may have gone away
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func getTrackedBranch(ctx context.Context, repoPath string) (string, error) {
+	cmd := gitCommand(ctx, "-C", repoPath, "rev-parse", "--abbrev-ref", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
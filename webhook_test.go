@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testWebhookSecret = "s3cret"
+
+// sign returns the hex HMAC-SHA256 of body, as GitHub, Gitea and Forgejo send it.
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	w := &webhookServer{secret: testWebhookSecret}
+	body := `{"ref":"refs/heads/main"}`
+	tests := []struct {
+		name      string
+		signature string
+		want      string // Error, "" when accepted
+	}{
+		{"valid", sign(testWebhookSecret, body), ""},
+		{"upper case hex", strings.ToUpper(sign(testWebhookSecret, body)), ""},
+		{"missing", "", "missing signature"},
+		{"not hex", "xyz", "malformed signature"},
+		{"other secret", sign("other", body), "signature mismatch"},
+		{"other body", sign(testWebhookSecret, body+" "), "signature mismatch"},
+		{"truncated", sign(testWebhookSecret, body)[:32], "signature mismatch"},
+	}
+	for _, tt := range tests {
+		err := w.verifyHMAC(tt.signature, []byte(body))
+		if got := errorString(err); got != tt.want {
+			t.Errorf("%s: verifyHMAC = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	w := &webhookServer{secret: testWebhookSecret}
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{testWebhookSecret, ""},
+		{"", "missing token"},
+		{"s3cre", "token mismatch"},
+		{testWebhookSecret + "x", "token mismatch"},
+		{strings.ToUpper(testWebhookSecret), "token mismatch"},
+	}
+	for _, tt := range tests {
+		if got := errorString(w.verifyToken(tt.token)); got != tt.want {
+			t.Errorf("verifyToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookAuthenticate(t *testing.T) {
+	w := &webhookServer{secret: testWebhookSecret}
+	body := `{"ref":"refs/heads/main"}`
+	valid := sign(testWebhookSecret, body)
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		provider string
+		event    string
+		wantErr  string
+	}{
+		{"GitHub", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + valid}, "GitHub", "push", ""},
+		{"GitHub without sha256 prefix", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": valid}, "GitHub", "", "missing X-Hub-Signature-256"},
+		{"GitHub SHA-1 only", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha1=abc"}, "GitHub", "", "missing X-Hub-Signature-256"},
+		{"Gitea", map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Signature": valid}, "Gitea", "push", ""},
+		{"Gitea bad signature", map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign("other", body)}, "Gitea", "push", "signature mismatch"},
+		{"Forgejo", map[string]string{"X-Forgejo-Event": "push", "X-Gitea-Event": "push", "X-Forgejo-Signature": valid}, "Forgejo", "push", ""},
+		{"Forgejo with Gitea signature", map[string]string{"X-Forgejo-Event": "push", "X-Gitea-Signature": valid}, "Forgejo", "push", ""},
+		{"GitLab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testWebhookSecret}, "GitLab", "Push Hook", ""},
+		{"GitLab wrong token", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "nope"}, "GitLab", "Push Hook", "token mismatch"},
+		{"GitLab without token", map[string]string{"X-Gitlab-Event": "Push Hook"}, "GitLab", "Push Hook", "missing token"},
+		{"unknown provider", map[string]string{"X-Hub-Signature-256": "sha256=" + valid}, "", "", "unrecognized webhook provider"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		for key, value := range tt.headers {
+			r.Header.Set(key, value)
+		}
+		provider, event, err := w.authenticate(r, []byte(body))
+		if provider != tt.provider || event != tt.event || errorString(err) != tt.wantErr {
+			t.Errorf("%s: authenticate = %q, %q, %v, want %q, %q, %q", tt.name, provider, event, err, tt.provider, tt.event, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookRejectsUnauthenticatedPush(t *testing.T) {
+	triggered := false
+	w := &webhookServer{secret: testWebhookSecret, trigger: func() { triggered = true }}
+	saved := consoleOutput
+	consoleOutput = &strings.Builder{}
+	t.Cleanup(func() { consoleOutput = saved })
+
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"ref":"refs/heads/main"}`))
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+sign("other", `{"ref":"refs/heads/main"}`))
+	rw := httptest.NewRecorder()
+	w.handlePush(rw, r)
+	if rw.Code != http.StatusUnauthorized || triggered {
+		t.Errorf("handlePush = %d, triggered %v; want 401 and no sync", rw.Code, triggered)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,1007 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A YAML parser for the subset compose files and project settings use, so
+// the binary stays free of third-party dependencies. It handles block and
+// flow collections, plain, quoted and block scalars, comments, anchors,
+// aliases, merge keys and tags on block values (kept for the caller to
+// interpret). Complex keys, multiple documents, anchors and tags inside flow
+// collections, and aliases expanding past maxAliasExpansion values are
+// rejected rather than misread.
+
+type yamlKind int
+
+const (
+	yamlNull yamlKind = iota
+	yamlScalar
+	yamlMapping
+	yamlSequence
+)
+
+// yamlNode is a parsed YAML value. Line is where it starts (1-based).
+type yamlNode struct {
+	Kind   yamlKind
+	Value  string      // Scalars
+	Quoted bool        // Quoted or block scalars are always strings
+	Pairs  []yamlPair  // Mappings, in document order
+	Items  []*yamlNode // Sequences
+	Tag    string      // Such as "!reset"; empty for untagged values
+	Line   int
+}
+
+type yamlPair struct {
+	Key   string
+	Line  int
+	Value *yamlNode
+}
+
+// yamlError is a syntax error at a line of the document.
+type yamlError struct {
+	Line int
+	Msg  string
+}
+
+func (e *yamlError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// get returns the value of key in a mapping, or nil.
+func (n *yamlNode) get(key string) *yamlNode {
+	if n == nil || n.Kind != yamlMapping {
+		return nil
+	}
+	for _, pair := range n.Pairs {
+		if pair.Key == key {
+			return pair.Value
+		}
+	}
+	return nil
+}
+
+// describe names the node's type for error messages.
+func (n *yamlNode) describe() string {
+	switch n.Kind {
+	case yamlMapping:
+		return "a mapping"
+	case yamlSequence:
+		return "a list"
+	case yamlNull:
+		return "empty"
+	}
+	return fmt.Sprintf("%q", n.Value)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string // Without indentation, comment and trailing space
+	raw    string // As written, for block scalars
+}
+
+type yamlParser struct {
+	lines    []yamlLine
+	pos      int
+	anchors  map[string]*yamlNode
+	sizes    map[*yamlNode]int // Of aliased nodes and their children
+	expanded int               // Values repeated by aliases so far
+}
+
+// maxAliasExpansion bounds the values aliases may repeat, so that a small
+// document can't expand into a huge one once formatted.
+const maxAliasExpansion = 100000
+
+// parseYAML parses a single YAML document. An empty document is a null node.
+func parseYAML(data string) (*yamlNode, error) {
+	data = strings.TrimPrefix(data, "\uFEFF")
+	if !utf8.ValidString(data) {
+		return nil, &yamlError{Line: 1, Msg: "not valid UTF-8"}
+	}
+	if i := strings.IndexFunc(data, func(r rune) bool { return !yamlPrintable(r) }); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(data[i:])
+		return nil, &yamlError{Line: strings.Count(data[:i], "\n") + 1, Msg: fmt.Sprintf("control character %U is not allowed; escape it in a double-quoted string", r)}
+	}
+
+	p := &yamlParser{anchors: make(map[string]*yamlNode), sizes: make(map[*yamlNode]int)}
+	// A lone carriage return breaks lines too. The line break ending the last
+	// line doesn't start another one, which would count as a blank line kept
+	// by a "|+" scalar
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
+	data = strings.TrimSuffix(data, "\n")
+	for i, raw := range strings.Split(data, "\n") {
+		text := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, yamlLine{
+			num:    i + 1,
+			indent: len(raw) - len(text),
+			text:   strings.TrimRight(stripYAMLComment(text), " \t"),
+			raw:    raw,
+		})
+	}
+
+	p.skipBlank()
+	if p.pos < len(p.lines) && p.cur().text == "---" {
+		p.pos++
+	}
+	node, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if p.pos < len(p.lines) && p.cur().text == "..." {
+		p.pos++
+		p.skipBlank()
+	}
+	if p.pos < len(p.lines) {
+		line := p.cur()
+		if line.text == "---" {
+			return nil, p.errorf(line.num, "multiple documents are not supported")
+		}
+		return nil, p.errorf(line.num, "unexpected content %q", line.text)
+	}
+	return node, nil
+}
+
+// yamlPrintable reports whether YAML allows r to appear in a document.
+func yamlPrintable(r rune) bool {
+	switch {
+	case r == '\t', r == '\n', r == '\r', r >= 0x20 && r <= 0x7e, r == 0x85:
+		return true
+	case r >= 0xa0 && r <= 0xd7ff, r >= 0xe000 && r <= 0xfffd, r >= 0x10000:
+		return true
+	}
+	return false
+}
+
+func (p *yamlParser) errorf(line int, format string, args ...interface{}) error {
+	return &yamlError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *yamlParser) cur() yamlLine {
+	return p.lines[p.pos]
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && strings.TrimSpace(p.cur().text) == "" {
+		p.pos++
+	}
+}
+
+// nullAt is an absent value, placed at the line that would have held it.
+func (p *yamlParser) nullAt(line int) *yamlNode {
+	return &yamlNode{Kind: yamlNull, Line: line}
+}
+
+// parseBlock parses the node starting at the next non-blank line if that line
+// is indented at least minIndent; otherwise the node is null.
+func (p *yamlParser) parseBlock(minIndent int) (*yamlNode, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) || p.cur().indent < minIndent {
+		line := len(p.lines)
+		if p.pos < len(p.lines) {
+			line = p.cur().num
+		}
+		return p.nullAt(line), nil
+	}
+
+	line := p.cur()
+	switch {
+	case strings.HasPrefix(line.text, "\t"):
+		return nil, p.errorf(line.num, "tabs are not allowed in indentation")
+	case line.text == "---" || line.text == "...":
+		return p.nullAt(line.num), nil
+	case isSequenceEntry(line.text):
+		return p.parseSequence(line.indent)
+	case strings.HasPrefix(line.text, "? "):
+		return nil, p.errorf(line.num, "complex mapping keys are not supported")
+	case mappingColon(line.text) >= 0:
+		return p.parseMapping(line.indent)
+	}
+	return p.parseValue(line.text, line.indent-1, false)
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{Kind: yamlMapping, Line: p.cur().num}
+	seen := make(map[string]int)
+	var merges []*yamlNode
+
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			break
+		}
+		line := p.cur()
+		if line.indent < indent || line.text == "---" || line.text == "..." {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line.num, "unexpected indentation")
+		}
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, p.errorf(line.num, "tabs are not allowed in indentation")
+		}
+
+		colon := mappingColon(line.text)
+		if colon < 0 {
+			if isSequenceEntry(line.text) {
+				return nil, p.errorf(line.num, "expected a mapping key, found a list item")
+			}
+			return nil, p.errorf(line.num, "expected \"key: value\", found %q", line.text)
+		}
+		key, quoted, err := parseYAMLKey(line.text[:colon])
+		if err != nil {
+			return nil, p.errorf(line.num, "%v", err)
+		}
+
+		value, err := p.parseValue(strings.TrimSpace(line.text[colon+1:]), indent, true)
+		if err != nil {
+			return nil, err
+		}
+		if key == "<<" && !quoted {
+			merges = append(merges, value)
+			continue
+		}
+		if first, dup := seen[key]; dup {
+			return nil, p.errorf(line.num, "duplicate key %q (first defined on line %d)", key, first)
+		}
+		seen[key] = line.num
+		node.Pairs = append(node.Pairs, yamlPair{Key: key, Line: line.num, Value: value})
+	}
+
+	// Keys written out in the mapping win over merged ones, and earlier
+	// merges win over later ones
+	for _, merge := range merges {
+		sources := []*yamlNode{merge}
+		if merge.Kind == yamlSequence {
+			sources = merge.Items
+		}
+		for _, source := range sources {
+			if source.Kind != yamlMapping {
+				return nil, p.errorf(merge.Line, "merge key \"<<\" needs a mapping or a list of mappings, got %s", source.describe())
+			}
+			for _, pair := range source.Pairs {
+				if _, dup := seen[pair.Key]; !dup {
+					seen[pair.Key] = pair.Line
+					node.Pairs = append(node.Pairs, pair)
+				}
+			}
+		}
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{Kind: yamlSequence, Line: p.cur().num, Items: []*yamlNode{}}
+
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			break
+		}
+		line := p.cur()
+		if line.indent < indent || !isSequenceEntry(line.text) {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line.num, "unexpected indentation")
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var item *yamlNode
+		var err error
+		if isSequenceEntry(rest) || mappingColon(rest) >= 0 {
+			// A collection starting on the dash line: read the line again
+			// as if the dash were indentation
+			p.lines[p.pos].indent = indent + len(line.text) - len(rest)
+			p.lines[p.pos].text = rest
+			item, err = p.parseBlock(p.lines[p.pos].indent)
+		} else {
+			item, err = p.parseValue(rest, indent, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Items = append(node.Items, item)
+	}
+	return node, nil
+}
+
+// parseValue parses the value that begins with text on the current line.
+// Lines continuing it must be indented deeper than parentIndent. A mapping
+// value may also be a list at the key's own indentation (inMapping).
+func (p *yamlParser) parseValue(text string, parentIndent int, inMapping bool) (*yamlNode, error) {
+	lineNum := p.cur().num
+
+	// Properties come first, in either order
+	anchor, tag := "", ""
+	for len(text) > 0 && (text[0] == '&' && anchor == "" || text[0] == '!' && tag == "") {
+		name, rest, _ := strings.Cut(text, " ")
+		switch {
+		case name == "&":
+			return nil, p.errorf(lineNum, "anchor without a name")
+		case name == "!":
+			return nil, p.errorf(lineNum, "tag without a name")
+		case name[0] == '&':
+			anchor = name[1:]
+		default:
+			tag = name
+		}
+		text = strings.TrimSpace(rest)
+	}
+
+	var node *yamlNode
+	var err error
+	switch {
+	case text == "":
+		// The value is the block below, if any
+		p.pos++
+		p.skipBlank()
+		switch {
+		case p.pos < len(p.lines) && p.cur().indent > parentIndent:
+			node, err = p.parseBlock(parentIndent + 1)
+		case inMapping && p.pos < len(p.lines) && p.cur().indent == parentIndent && isSequenceEntry(p.cur().text):
+			node, err = p.parseSequence(parentIndent)
+		default:
+			node = p.nullAt(lineNum)
+		}
+	case text[0] == '*':
+		if anchor != "" || tag != "" {
+			return nil, p.errorf(lineNum, "an alias can't have an anchor or a tag")
+		}
+		aliased, err := p.alias(text[1:])
+		if err != nil {
+			return nil, p.errorf(lineNum, "%v", err)
+		}
+		p.pos++
+		return aliased, nil
+	case text[0] == '&' || text[0] == '!':
+		return nil, p.errorf(lineNum, "a value can't have two anchors or tags")
+	case text[0] == '|' || text[0] == '>':
+		node, err = p.parseBlockScalar(text, parentIndent)
+	case text[0] == '[' || text[0] == '{':
+		node, err = p.parseFlow(text, parentIndent)
+	case text[0] == '"' || text[0] == '\'':
+		node, err = p.parseQuoted(text, parentIndent)
+	default:
+		node, err = p.parsePlain(text, parentIndent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		node.Tag = tag
+	}
+	if anchor != "" {
+		p.anchors[anchor] = node
+	}
+	return node, nil
+}
+
+// alias returns the node anchored as name.
+func (p *yamlParser) alias(name string) (*yamlNode, error) {
+	aliased, ok := p.anchors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown alias %q", name)
+	}
+	if p.expanded += p.size(aliased); p.expanded > maxAliasExpansion {
+		return nil, fmt.Errorf("aliases expand to more than %d values", maxAliasExpansion)
+	}
+	return aliased, nil
+}
+
+// size counts the values in a node, as aliases expand them, up to just past
+// maxAliasExpansion.
+func (p *yamlParser) size(n *yamlNode) int {
+	if size, ok := p.sizes[n]; ok {
+		return size
+	}
+	size := 1
+	for _, pair := range n.Pairs {
+		size = min(size+p.size(pair.Value), maxAliasExpansion+1)
+	}
+	for _, item := range n.Items {
+		size = min(size+p.size(item), maxAliasExpansion+1)
+	}
+	p.sizes[n] = size
+	return size
+}
+
+// parsePlain parses an unquoted scalar, folding continuation lines.
+func (p *yamlParser) parsePlain(text string, parentIndent int) (*yamlNode, error) {
+	lineNum := p.cur().num
+	for p.pos++; p.pos < len(p.lines); p.pos++ {
+		line := p.cur()
+		if strings.TrimSpace(line.text) == "" || line.indent <= parentIndent {
+			break
+		}
+		text += " " + line.text
+	}
+
+	if strings.Contains(text, ": ") || strings.HasSuffix(text, ":") {
+		return nil, p.errorf(lineNum, "mapping values are not allowed here; quote the value if it contains \": \"")
+	}
+	if err := checkPlain(text); err != nil {
+		return nil, p.errorf(lineNum, "%v", err)
+	}
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return p.nullAt(lineNum), nil
+	}
+	return &yamlNode{Kind: yamlScalar, Value: text, Line: lineNum}, nil
+}
+
+// parseQuoted parses a single- or double-quoted scalar, which may span lines.
+func (p *yamlParser) parseQuoted(text string, parentIndent int) (*yamlNode, error) {
+	lineNum := p.cur().num
+	// Quoted scalars may contain "#", so work from the line as written; text
+	// ends the line, less its comment
+	line := p.cur()
+	raw := strings.TrimRight(line.raw[line.indent+len(line.text)-len(text):], " \t")
+	for p.pos++; !quoteClosed(raw) && p.pos < len(p.lines); p.pos++ {
+		next := p.cur()
+		if strings.TrimSpace(next.raw) != "" && next.indent <= parentIndent {
+			break
+		}
+		raw += "\n" + strings.TrimSpace(next.raw)
+	}
+
+	value, n, err := unquoteYAML(raw)
+	if err != nil {
+		return nil, p.errorf(lineNum, "%v", err)
+	}
+	if rest := strings.TrimSpace(stripYAMLComment(raw[n:])); rest != "" {
+		return nil, p.errorf(lineNum, "unexpected %q after quoted string", rest)
+	}
+	return &yamlNode{Kind: yamlScalar, Value: value, Quoted: true, Line: lineNum}, nil
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar.
+func (p *yamlParser) parseBlockScalar(header string, parentIndent int) (*yamlNode, error) {
+	lineNum := p.cur().num
+	folded := header[0] == '>'
+	chomp := byte(0)
+	contentIndent := -1 // Taken from the first line unless the header sets it
+	for _, c := range header[1:] {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = byte(c)
+		case c >= '1' && c <= '9' && contentIndent < 0:
+			contentIndent = max(parentIndent, 0) + int(c-'0')
+		default:
+			return nil, p.errorf(lineNum, "invalid block scalar header %q", header)
+		}
+	}
+
+	var lines []string
+	for p.pos++; p.pos < len(p.lines); p.pos++ {
+		raw := p.cur().raw
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		indent := p.cur().indent
+		if indent <= parentIndent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = indent
+		}
+		if indent < contentIndent {
+			break
+		}
+		lines = append(lines, raw[contentIndent:])
+	}
+
+	// Trailing blank lines only matter for chomping
+	trailing := 0
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case !folded || prev == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(prev, " "):
+				b.WriteByte('\n')
+			case line == "":
+				// Folding a blank line leaves just its own line break, unless
+				// more-indented lines follow
+				if strings.HasPrefix(lines[i+1], " ") {
+					b.WriteByte('\n')
+				}
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	value := b.String()
+	switch {
+	case value == "":
+	case chomp == '+':
+		value += strings.Repeat("\n", trailing+1)
+	case chomp != '-':
+		value += "\n"
+	}
+	return &yamlNode{Kind: yamlScalar, Value: value, Quoted: true, Line: lineNum}, nil
+}
+
+// parseFlow parses a flow collection ([...] or {...}), joining the lines it
+// spans.
+func (p *yamlParser) parseFlow(text string, parentIndent int) (*yamlNode, error) {
+	lineNum := p.cur().num
+	for p.pos++; !flowBalanced(text) && p.pos < len(p.lines); p.pos++ {
+		line := p.cur()
+		if strings.TrimSpace(line.text) == "" {
+			continue
+		}
+		// The closing bracket may line up with the key
+		closing := line.indent == parentIndent && strings.ContainsAny(line.text[:1], "]}")
+		if line.indent <= parentIndent && !closing {
+			break
+		}
+		text += " " + line.text
+	}
+
+	f := &flowParser{s: text, line: lineNum, p: p}
+	node, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpaces()
+	if f.i < len(f.s) {
+		return nil, p.errorf(lineNum, "unexpected %q after flow collection", f.s[f.i:])
+	}
+	return node, nil
+}
+
+type flowParser struct {
+	s    string
+	i    int
+	line int
+	p    *yamlParser // For aliases
+}
+
+func (f *flowParser) errorf(format string, args ...interface{}) error {
+	return &yamlError{Line: f.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (f *flowParser) skipSpaces() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+func (f *flowParser) value() (*yamlNode, error) {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return nil, f.errorf("unterminated flow collection")
+	}
+
+	switch c := f.s[f.i]; c {
+	case '[':
+		node := &yamlNode{Kind: yamlSequence, Line: f.line, Items: []*yamlNode{}}
+		f.i++
+		for {
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return node, nil
+			}
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Items = append(node.Items, item)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		node := &yamlNode{Kind: yamlMapping, Line: f.line}
+		seen := make(map[string]bool)
+		f.i++
+		for {
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return node, nil
+			}
+			key, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			if key.Kind == yamlMapping || key.Kind == yamlSequence {
+				return nil, f.errorf("complex mapping keys are not supported")
+			}
+			value := &yamlNode{Kind: yamlNull, Line: f.line}
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == ':' {
+				f.i++
+				f.skipSpaces()
+				if f.i < len(f.s) && f.s[f.i] != ',' && f.s[f.i] != '}' {
+					if value, err = f.value(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if seen[key.Value] {
+				return nil, f.errorf("duplicate key %q", key.Value)
+			}
+			seen[key.Value] = true
+			node.Pairs = append(node.Pairs, yamlPair{Key: key.Value, Line: f.line, Value: value})
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		value, n, err := unquoteYAML(f.s[f.i:])
+		if err != nil {
+			return nil, f.errorf("%v", err)
+		}
+		f.i += n
+		return &yamlNode{Kind: yamlScalar, Value: value, Quoted: true, Line: f.line}, nil
+	case '*':
+		start := f.i + 1
+		for f.i++; f.i < len(f.s) && !strings.ContainsRune(" ,]}", rune(f.s[f.i])); f.i++ {
+		}
+		aliased, err := f.p.alias(f.s[start:f.i])
+		if err != nil {
+			return nil, f.errorf("%v", err)
+		}
+		return aliased, nil
+	case ']', '}', ',':
+		return nil, f.errorf("unexpected %q in flow collection", c)
+	case '&', '!':
+		return nil, f.errorf("anchors and tags are not supported in flow collections")
+	}
+
+	// Plain scalar: up to a separator, or a ": " ending a key
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if c == ':' && (f.i+1 == len(f.s) || strings.ContainsRune(" ,]}", rune(f.s[f.i+1]))) {
+			break
+		}
+	}
+	value := strings.TrimSpace(f.s[start:f.i])
+	if err := checkPlain(value); err != nil {
+		return nil, f.errorf("%v", err)
+	}
+	switch value {
+	case "~", "null", "Null", "NULL":
+		return &yamlNode{Kind: yamlNull, Line: f.line}, nil
+	}
+	return &yamlNode{Kind: yamlScalar, Value: value, Line: f.line}, nil
+}
+
+// separator consumes the "," between flow entries, or stops at the closing
+// bracket without consuming it.
+func (f *flowParser) separator(closing byte) error {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return f.errorf("unterminated flow collection, expected %q", closing)
+	}
+	switch f.s[f.i] {
+	case ',':
+		f.i++
+		return nil
+	case closing:
+		return nil
+	}
+	return f.errorf("expected \",\" or %q in flow collection, found %q", closing, f.s[f.i:])
+}
+
+// checkPlain rejects a plain scalar starting with a character YAML reserves
+// for other syntax, or holding a comment, which would read back as something
+// else once formatted.
+func checkPlain(value string) error {
+	if value == "" {
+		return nil
+	}
+	c := value[0]
+	if strings.ContainsRune(",[]{}#&*!|>'\"%@`", rune(c)) ||
+		strings.ContainsRune("-?:", rune(c)) && (len(value) == 1 || value[1] == ' ') {
+		return fmt.Errorf("a plain value can't start with %q; quote the value", c)
+	}
+	if strings.Contains(value, " #") || strings.Contains(value, "\t#") {
+		return fmt.Errorf("a plain value can't contain \" #\"; quote the value")
+	}
+	return nil
+}
+
+// isSequenceEntry reports whether a line starts a block sequence item.
+func isSequenceEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// mappingColon returns the index of the ":" ending a mapping key on the line,
+// or -1 if the line isn't "key: value".
+func mappingColon(text string) int {
+	i := 0
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		_, n, err := unquoteYAML(text)
+		if err != nil {
+			return -1
+		}
+		i = n
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		if i < len(text) && text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+		return -1
+	}
+	if text == "" || strings.ContainsRune("[{&*!|>", rune(text[0])) || isSequenceEntry(text) {
+		return -1
+	}
+	for ; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLKey unquotes a mapping key.
+func parseYAMLKey(raw string) (key string, quoted bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+		key, _, err = unquoteYAML(raw)
+		return key, true, err
+	}
+	if raw == "" {
+		return "", false, fmt.Errorf("empty mapping key")
+	}
+	return raw, false, nil
+}
+
+// quoteClosed reports whether the quoted scalar starting s ends in s.
+func quoteClosed(s string) bool {
+	_, _, err := unquoteYAML(s)
+	return err == nil
+}
+
+// flowBalanced reports whether every bracket opened in s is closed.
+func flowBalanced(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if _, n, err := unquoteYAML(s[i:]); err == nil {
+				i += n - 1
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// unquoteYAML decodes the quoted scalar at the start of s and returns it with
+// the number of bytes it took up. Line breaks inside fold into spaces.
+func unquoteYAML(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			b.WriteByte(' ')
+		case c == '\\' && quote == '"':
+			i++
+			if i >= len(s) {
+				break
+			}
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't', '\t':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case ' ', '"', '\\', '/':
+				b.WriteByte(e)
+			case 'a', 'b', 'e', 'f', 'v':
+				b.WriteByte(map[byte]byte{'a': '\a', 'b': '\b', 'e': 0x1b, 'f': '\f', 'v': '\v'}[e])
+			case 'N', '_', 'L', 'P':
+				b.WriteRune(map[byte]rune{'N': '\u0085', '_': '\u00a0', 'L': '\u2028', 'P': '\u2029'}[e])
+			case '\n':
+				// Escaped line break: joined without a space
+			case 'x', 'u', 'U':
+				digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+digits >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape \\%c in double-quoted string", e)
+				}
+				code, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape \\%s in double-quoted string", s[i:i+1+digits])
+				}
+				b.WriteRune(rune(code))
+				i += digits
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c in double-quoted string", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated %s-quoted string", map[byte]string{'"': "double", '\'': "single"}[quote])
+}
+
+// stripYAMLComment removes a "#" comment from a line, leaving "#" inside
+// quoted scalars and words alone.
+func stripYAMLComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		case '"', '\'':
+			// Only a quote at the start of a value opens a quoted scalar
+			prev := strings.TrimRight(s[:i], " \t")
+			if prev == "" || strings.ContainsRune(":-[{,?", rune(prev[len(prev)-1])) {
+				if _, n, err := unquoteYAML(s[i:]); err == nil {
+					i += n - 1
+				} else {
+					// Continues on the next line
+					return s
+				}
+			}
+		}
+	}
+	return s
+}
+
+// formatYAML writes a node as a block-style document. Scalars keep their
+// type: plain ones are written plain, quoted and block scalars stay strings.
+func formatYAML(n *yamlNode) string {
+	var b strings.Builder
+	if n.Tag != "" {
+		// The tag goes first, on the line a key would take
+		writeYAMLValue(&b, n, 0)
+		return strings.TrimPrefix(b.String(), " ")
+	}
+	switch {
+	case n.Kind == yamlMapping && len(n.Pairs) > 0:
+		writeYAMLMapping(&b, n, 0)
+	case n.Kind == yamlSequence && len(n.Items) > 0:
+		writeYAMLSequence(&b, n, 0)
+	default:
+		b.WriteString(strings.TrimPrefix(yamlInline(n, 0), " ") + "\n")
+	}
+	return b.String()
+}
+
+func writeYAMLMapping(b *strings.Builder, n *yamlNode, indent int) {
+	for _, pair := range n.Pairs {
+		b.WriteString(strings.Repeat(" ", indent) + formatYAMLKey(pair.Key) + ":")
+		writeYAMLValue(b, pair.Value, indent+2)
+	}
+}
+
+func writeYAMLSequence(b *strings.Builder, n *yamlNode, indent int) {
+	for _, item := range n.Items {
+		if item.Tag == "" && (item.Kind == yamlMapping && len(item.Pairs) > 0 || item.Kind == yamlSequence && len(item.Items) > 0) {
+			// The collection starts on the dash line
+			var nested strings.Builder
+			writeYAMLValue(&nested, item, indent+2)
+			b.WriteString(strings.Repeat(" ", indent) + "- " + strings.TrimLeft(strings.TrimPrefix(nested.String(), "\n"), " "))
+			continue
+		}
+		b.WriteString(strings.Repeat(" ", indent) + "-")
+		writeYAMLValue(b, item, indent+2)
+	}
+}
+
+// writeYAMLValue writes what follows a key's colon or a list item's dash.
+func writeYAMLValue(b *strings.Builder, n *yamlNode, indent int) {
+	if n.Tag != "" {
+		b.WriteString(" " + n.Tag)
+	}
+	switch {
+	case n.Kind == yamlMapping && len(n.Pairs) > 0:
+		b.WriteString("\n")
+		writeYAMLMapping(b, n, indent)
+	case n.Kind == yamlSequence && len(n.Items) > 0:
+		b.WriteString("\n")
+		writeYAMLSequence(b, n, indent)
+	default:
+		b.WriteString(yamlInline(n, indent) + "\n")
+	}
+}
+
+// yamlInline formats a scalar, null or empty collection, with its leading
+// space. Multi-line strings become literal block scalars indented by indent.
+func yamlInline(n *yamlNode, indent int) string {
+	switch {
+	case n.Kind == yamlNull:
+		return ""
+	case n.Kind == yamlMapping:
+		return " {}"
+	case n.Kind == yamlSequence:
+		return " []"
+	case !n.Quoted && n.Value != "" && !strings.Contains(n.Value, "\n"):
+		return " " + n.Value
+	case literalBlockSafe(n.Value):
+		content := strings.TrimRight(n.Value, "\n")
+		trailing := len(n.Value) - len(content)
+		lines := strings.Split(content, "\n")
+		for i := 1; i < trailing; i++ {
+			lines = append(lines, "")
+		}
+
+		// Chomping indicator: strip, clip or keep the final line breaks
+		var b strings.Builder
+		switch trailing {
+		case 0:
+			b.WriteString(" |-")
+		case 1:
+			b.WriteString(" |")
+		default:
+			b.WriteString(" |+")
+		}
+		for _, line := range lines {
+			b.WriteString("\n")
+			if line != "" {
+				b.WriteString(strings.Repeat(" ", indent) + line)
+			}
+		}
+		return b.String()
+	}
+	return " " + strconv.Quote(n.Value)
+}
+
+// literalBlockSafe reports whether a string reads back unchanged as a literal
+// block scalar.
+func literalBlockSafe(s string) bool {
+	if !strings.Contains(strings.TrimRight(s, "\n"), "\n") || strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\n") {
+		return false
+	}
+	for _, r := range s {
+		if r != '\n' && r != '\t' && !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatYAMLKey leaves ordinary keys plain and quotes anything that could read
+// back differently.
+func formatYAMLKey(key string) string {
+	switch strings.ToLower(key) {
+	case "", "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return strconv.Quote(key)
+	}
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.' || r == '/'):
+		default:
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/yaml")
+
+// sameYAML compares two nodes, ignoring line numbers.
+func sameYAML(a, b *yamlNode) bool {
+	if a.Kind != b.Kind || a.Value != b.Value || a.Quoted != b.Quoted || a.Tag != b.Tag ||
+		len(a.Pairs) != len(b.Pairs) || len(a.Items) != len(b.Items) {
+		return false
+	}
+	for i := range a.Pairs {
+		if a.Pairs[i].Key != b.Pairs[i].Key || !sameYAML(a.Pairs[i].Value, b.Pairs[i].Value) {
+			return false
+		}
+	}
+	for i := range a.Items {
+		if !sameYAML(a.Items[i], b.Items[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFormatYAMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // formatYAML's output
+	}{
+		{
+			name: "block collections",
+			in: `services:
+  web:
+    image: nginx:1.29   # pinned
+    ports:
+      - "8080:80"
+      - 443:443
+`,
+			want: `services:
+  web:
+    image: nginx:1.29
+    ports:
+      - "8080:80"
+      - 443:443
+`,
+		},
+		{
+			name: "flow collections",
+			in:   "command: [\"sh\", \"-c\", 'echo hi']\nlabels: {a: 1, b: \"two\"}\nempty: []\nnone: {}\n",
+			want: "command:\n  - \"sh\"\n  - \"-c\"\n  - \"echo hi\"\nlabels:\n  a: 1\n  b: \"two\"\nempty: []\nnone: {}\n",
+		},
+		{
+			name: "block scalars",
+			in:   "script: |\n  echo one\n  echo two\nfolded: >-\n  one\n  two\nkept: |+\n  a\n  b\n\n",
+			want: "script: |\n  echo one\n  echo two\nfolded: \"one two\"\nkept: |+\n  a\n  b\n\n",
+		},
+		{
+			name: "sequence of mappings",
+			in:   "volumes:\n  - type: bind\n    source: ./data\n    target: /data\n  -\n    - nested\n",
+			want: "volumes:\n  - type: bind\n    source: ./data\n    target: /data\n  - - nested\n",
+		},
+		{
+			name: "nulls and tags",
+			in:   "a:\nb: ~\nports: !reset []\nenv: !override\n  X: 1\n",
+			want: "a:\nb:\nports: !reset []\nenv: !override\n  X: 1\n",
+		},
+		{
+			name: "anchors and aliases",
+			in:   "x-base: &base\n  restart: always\nservices:\n  web:\n    logging: *base\n",
+			want: "x-base:\n  restart: always\nservices:\n  web:\n    logging:\n      restart: always\n",
+		},
+		{
+			name: "keys needing quotes",
+			in:   "\"yes\": 1\n\"a b\": 2\n'9lives': 3\nkebab-case.key: 4\n",
+			want: "\"yes\": 1\n\"a b\": 2\n\"9lives\": 3\nkebab-case.key: 4\n",
+		},
+		{
+			name: "escapes",
+			in:   "a: \"tab\\there\"\nb: 'it''s'\nc: \"\\u00e9\"\n",
+			want: "a: \"tab\\there\"\nb: \"it's\"\nc: \"é\"\n",
+		},
+		{
+			name: "document markers",
+			in:   "---\nkey: value\n...\n",
+			want: "key: value\n",
+		},
+		{
+			name: "tagged document",
+			in:   "!override\nkey: value\n",
+			want: "!override\nkey: value\n",
+		},
+		{
+			name: "line breaks",
+			in:   "a: 1\rb: \"\\v\\e\"\r\nc: |\n  one\n\n   two\n",
+			want: "a: 1\nb: \"\\v\\x1b\"\nc: |\n  one\n\n   two\n",
+		},
+		{
+			name: "scalar document",
+			in:   "hello\n",
+			want: "hello\n",
+		},
+		{
+			name: "empty document",
+			in:   "# nothing here\n",
+			want: "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseYAML(tt.in)
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			got := formatYAML(doc)
+			if got != tt.want {
+				t.Errorf("formatYAML:\n%s\nwant:\n%s", got, tt.want)
+			}
+
+			again, err := parseYAML(got)
+			if err != nil {
+				t.Fatalf("parseYAML of the formatted document: %v", err)
+			}
+			if !sameYAML(doc, again) {
+				t.Errorf("formatted document reads back differently:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		line int
+		msg  string // Part of the message
+	}{
+		{"a: 1\n b: 2\n", 1, "mapping values are not allowed"},
+		{"a: [1, 2\n", 1, "unterminated"},
+		{"a: \"open\n", 1, ""},
+		{"a: *missing\n", 1, "unknown alias"},
+		{"a: 1\n---\nb: 2\n", 2, ""},
+		{"a: \"\\q\"\n", 1, "invalid escape"},
+		{"a: 1\n\xff: 2\n", 1, "UTF-8"},
+		{"a: 1\nb: \"x\ny\f\"\n", 3, "control character U+000C"},
+		{"a: [!reset x]\n", 1, "not supported in flow collections"},
+		{"a: [&x 1]\n", 1, "not supported in flow collections"},
+		{"a: @daily\n", 1, "can't start with '@'"},
+		{"a: [- b]\n", 1, "can't start with '-'"},
+		{"a: b\n  \" #\n", 1, "can't contain"},
+		{"a: &a [x, x, x, x, x, x, x, x, x, x]\nb: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\nc: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\n" +
+			"d: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]\ne: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d, *d]\n", 5, "aliases expand"},
+	}
+	for _, tt := range tests {
+		_, err := parseYAML(tt.in)
+		lineErr, ok := err.(*yamlError)
+		if !ok {
+			t.Errorf("parseYAML(%q) = %v, want a yamlError", tt.in, err)
+			continue
+		}
+		if lineErr.Line != tt.line || !strings.Contains(lineErr.Msg, tt.msg) {
+			t.Errorf("parseYAML(%q) = line %d: %s, want line %d: ...%s...", tt.in, lineErr.Line, lineErr.Msg, tt.line, tt.msg)
+		}
+	}
+}
+
+// TestParseYAMLGolden formats the compose files in testdata/yaml and compares
+// the result with the .golden file next to each. Files the parser rejects have
+// the error in their .golden file instead.
+func TestParseYAMLGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "yaml", "*.yaml"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no compose files in testdata/yaml: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			doc, err := parseYAML(string(data))
+			if err != nil {
+				got = "error: " + err.Error() + "\n"
+			} else {
+				got = formatYAML(doc)
+				again, err := parseYAML(got)
+				if err != nil {
+					t.Fatalf("parseYAML of the formatted document: %v", err)
+				}
+				if !sameYAML(doc, again) {
+					t.Errorf("formatted document reads back differently:\n%s", got)
+				}
+			}
+
+			golden := strings.TrimSuffix(file, ".yaml") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant (%s):\n%s", got, golden, want)
+			}
+		})
+	}
+}
+
+func FuzzParseYAML(f *testing.F) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "yaml", "*.yaml"))
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			f.Add(string(data))
+		}
+	}
+	for _, seed := range []string{
+		"services:\n  web:\n    image: nginx\n    ports: [\"80:80\"]\n",
+		"x: &a {b: 1}\ny: *a\nz:\n  <<: *a\n  c: 2\n",
+		"s: |2\n    indented\n  text\nt: >-\n  folded\n  lines\n",
+		"\"quoted key\": 'value'\n- item\n",
+		"a: 1\n---\nb: 2\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		doc, err := parseYAML(in)
+		if err != nil {
+			if _, ok := err.(*yamlError); !ok {
+				t.Fatalf("parseYAML = %v, want a yamlError", err)
+			}
+			return
+		}
+		out := formatYAML(doc)
+		again, err := parseYAML(out)
+		if err != nil {
+			t.Fatalf("parseYAML of the formatted document: %v\n%s", err, out)
+		}
+		if !sameYAML(doc, again) {
+			t.Fatalf("formatted document reads back differently:\n%s", out)
+		}
+	})
+}